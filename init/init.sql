@@ -1,18 +1,66 @@
+CREATE TABLE IF NOT EXISTS users (
+    username VARCHAR(50) UNIQUE NOT NULL,
+    password VARCHAR(50) NOT NULL,
+    role VARCHAR(30) NOT NULL
+);
+
+ALTER TABLE users OWNER TO postgres;
+
 CREATE TABLE IF NOT EXISTS actors (
     actor_id SERIAL PRIMARY KEY,
     name VARCHAR(150) NOT NULL,
     sex VARCHAR(10),
-    date_of_birth DATE
+    date_of_birth DATE,
+    version INT NOT NULL DEFAULT 1,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    deleted_at TIMESTAMPTZ
 );
 
 ALTER TABLE actors OWNER TO postgres;
 
+CREATE TABLE IF NOT EXISTS actor_aliases (
+    alias_id SERIAL PRIMARY KEY,
+    actor_id INT NOT NULL REFERENCES actors(actor_id),
+    name VARCHAR(150) NOT NULL,
+    kind VARCHAR(20) NOT NULL DEFAULT 'other' CHECK (kind IN ('stage', 'birth', 'transliteration', 'other')),
+    UNIQUE (actor_id, name)
+);
+
+ALTER TABLE actor_aliases OWNER TO postgres;
+
+-- Audit trail of duplicate actors merged into a surviving actor. The target
+-- is a plain ID so the trail outlives it: it may itself be merged into another
+-- actor later, which adds the next link of the chain, or purged.
+CREATE TABLE IF NOT EXISTS actor_merges (
+    merge_id SERIAL PRIMARY KEY,
+    source_actor_id INT NOT NULL,
+    source_name VARCHAR(150) NOT NULL,
+    source_date_of_birth DATE,
+    target_actor_id INT NOT NULL,
+    movie_ids INT[] NOT NULL DEFAULT '{}',
+    merged_by VARCHAR(50) NOT NULL,
+    merged_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE actor_merges OWNER TO postgres;
+
 CREATE TABLE IF NOT EXISTS movies (
     movie_id SERIAL PRIMARY KEY,
     name VARCHAR(150) NOT NULL,
     description TEXT,
     release_date DATE,
-    rating FLOAT
+    editorial_rating FLOAT,
+    runtime_minutes INT CHECK (runtime_minutes > 0),
+    original_title VARCHAR(150),
+    original_language CHAR(2),
+    countries CHAR(2)[] NOT NULL DEFAULT '{}',
+    budget BIGINT CHECK (budget >= 0),
+    box_office BIGINT CHECK (box_office >= 0),
+    imdb_id VARCHAR(12) UNIQUE,
+    tmdb_id INT UNIQUE,
+    version INT NOT NULL DEFAULT 1,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    deleted_at TIMESTAMPTZ
 );
 
 ALTER TABLE movies OWNER TO postgres;
@@ -20,18 +68,321 @@ ALTER TABLE movies OWNER TO postgres;
 CREATE TABLE IF NOT EXISTS movies_actors (
     movie_id INT REFERENCES movies(movie_id),
     actor_id INT REFERENCES actors(actor_id),
+    characters TEXT[] NOT NULL DEFAULT '{}',
+    billing_order INT,
+    credit_type VARCHAR(20) CHECK (credit_type IN ('lead', 'supporting', 'cameo', 'voice')),
     PRIMARY KEY (movie_id, actor_id)
 );
 
 ALTER TABLE movies_actors OWNER TO postgres;
 
-CREATE INDEX movie_name_index ON movies(name);
-CREATE INDEX actor_name_index ON actors(name);
+CREATE TABLE IF NOT EXISTS movie_translations (
+    movie_id INT REFERENCES movies(movie_id),
+    language VARCHAR(5) NOT NULL,
+    name VARCHAR(150) NOT NULL,
+    description TEXT,
+    PRIMARY KEY (movie_id, language)
+);
 
-CREATE TABLE IF NOT EXISTS users (
-    username VARCHAR(50) UNIQUE NOT NULL,
-    password VARCHAR(50) NOT NULL,
-    role VARCHAR(30) NOT NULL
+ALTER TABLE movie_translations OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS actor_translations (
+    actor_id INT REFERENCES actors(actor_id),
+    language VARCHAR(5) NOT NULL,
+    name VARCHAR(150) NOT NULL,
+    PRIMARY KEY (actor_id, language)
 );
 
-ALTER TABLE users OWNER TO postgres;
\ No newline at end of file
+ALTER TABLE actor_translations OWNER TO postgres;
+
+-- An image belongs to exactly one movie or actor; its original and
+-- thumbnails are stored under storage_key.
+CREATE TABLE IF NOT EXISTS images (
+    image_id SERIAL PRIMARY KEY,
+    movie_id INT REFERENCES movies(movie_id),
+    actor_id INT REFERENCES actors(actor_id),
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('poster', 'backdrop', 'photo')),
+    storage_key VARCHAR(200) NOT NULL UNIQUE,
+    content_type VARCHAR(50) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (movie_id, kind),
+    UNIQUE (actor_id, kind),
+    CHECK ((movie_id IS NULL) <> (actor_id IS NULL))
+);
+
+ALTER TABLE images OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS movie_certifications (
+    movie_id INT REFERENCES movies(movie_id),
+    country CHAR(2) NOT NULL,
+    certification VARCHAR(50) NOT NULL,
+    PRIMARY KEY (movie_id, country)
+);
+
+ALTER TABLE movie_certifications OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS movie_ratings (
+    movie_id INT REFERENCES movies(movie_id),
+    username VARCHAR(50) REFERENCES users(username),
+    score NUMERIC(3,1) NOT NULL CHECK (score >= 0 AND score <= 10),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (movie_id, username)
+);
+
+ALTER TABLE movie_ratings OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS reviews (
+    review_id SERIAL PRIMARY KEY,
+    movie_id INT NOT NULL REFERENCES movies(movie_id),
+    username VARCHAR(50) NOT NULL REFERENCES users(username),
+    title VARCHAR(150) NOT NULL,
+    body TEXT NOT NULL,
+    spoiler BOOLEAN NOT NULL DEFAULT false,
+    hidden BOOLEAN NOT NULL DEFAULT false,
+    moderation_reason VARCHAR(1000),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (movie_id, username)
+);
+
+ALTER TABLE reviews OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS review_moderations (
+    moderation_id SERIAL PRIMARY KEY,
+    review_id INT NOT NULL,
+    movie_id INT NOT NULL,
+    author VARCHAR(50) NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('hide', 'unhide', 'delete')),
+    reason VARCHAR(1000),
+    moderator VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE review_moderations OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS watchlist (
+    username VARCHAR(50) REFERENCES users(username),
+    movie_id INT REFERENCES movies(movie_id),
+    added_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (username, movie_id)
+);
+
+ALTER TABLE watchlist OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS watched (
+    username VARCHAR(50) REFERENCES users(username),
+    movie_id INT REFERENCES movies(movie_id),
+    watched_on DATE NOT NULL DEFAULT current_date,
+    rewatch_count INT NOT NULL DEFAULT 0 CHECK (rewatch_count >= 0),
+    PRIMARY KEY (username, movie_id)
+);
+
+ALTER TABLE watched OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS collections (
+    collection_id SERIAL PRIMARY KEY,
+    username VARCHAR(50) NOT NULL REFERENCES users(username),
+    name VARCHAR(150) NOT NULL,
+    description VARCHAR(1000),
+    public BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE collections OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS collection_entries (
+    collection_id INT REFERENCES collections(collection_id),
+    movie_id INT REFERENCES movies(movie_id),
+    position INT NOT NULL,
+    note VARCHAR(1000),
+    PRIMARY KEY (collection_id, movie_id)
+);
+
+ALTER TABLE collection_entries OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS franchises (
+    franchise_id SERIAL PRIMARY KEY,
+    name VARCHAR(150) NOT NULL,
+    description VARCHAR(1000)
+);
+
+ALTER TABLE franchises OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS franchise_movies (
+    franchise_id INT NOT NULL REFERENCES franchises(franchise_id),
+    movie_id INT PRIMARY KEY REFERENCES movies(movie_id),
+    position INT NOT NULL
+);
+
+ALTER TABLE franchise_movies OWNER TO postgres;
+
+-- A row (a, b, 'sequel') says b is the sequel of a; (a, b, 'remake') says b
+-- is a remake of a.
+CREATE TABLE IF NOT EXISTS movie_relations (
+    movie_id INT REFERENCES movies(movie_id),
+    related_movie_id INT REFERENCES movies(movie_id),
+    relation VARCHAR(10) NOT NULL CHECK (relation IN ('sequel', 'remake')),
+    PRIMARY KEY (movie_id, related_movie_id),
+    CHECK (movie_id <> related_movie_id)
+);
+
+ALTER TABLE movie_relations OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS series (
+    series_id SERIAL PRIMARY KEY,
+    name VARCHAR(150) NOT NULL,
+    description TEXT,
+    first_air_date DATE,
+    last_air_date DATE,
+    rating FLOAT
+);
+
+ALTER TABLE series OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS seasons (
+    season_id SERIAL PRIMARY KEY,
+    series_id INT NOT NULL REFERENCES series(series_id),
+    number INT NOT NULL CHECK (number > 0),
+    name VARCHAR(150),
+    description TEXT,
+    UNIQUE (series_id, number)
+);
+
+ALTER TABLE seasons OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS episodes (
+    episode_id SERIAL PRIMARY KEY,
+    season_id INT NOT NULL REFERENCES seasons(season_id),
+    number INT NOT NULL CHECK (number > 0),
+    name VARCHAR(150) NOT NULL,
+    description TEXT,
+    air_date DATE,
+    runtime_minutes INT CHECK (runtime_minutes > 0),
+    rating FLOAT,
+    UNIQUE (season_id, number)
+);
+
+ALTER TABLE episodes OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS episodes_actors (
+    episode_id INT REFERENCES episodes(episode_id),
+    actor_id INT REFERENCES actors(actor_id),
+    characters TEXT[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (episode_id, actor_id)
+);
+
+ALTER TABLE episodes_actors OWNER TO postgres;
+
+-- Every change of a movie or actor: the state after the change and the fields
+-- that differ from the previous revision. A movie's snapshot includes its cast.
+CREATE TABLE IF NOT EXISTS revisions (
+    revision_id SERIAL PRIMARY KEY,
+    entity_type VARCHAR(10) NOT NULL CHECK (entity_type IN ('movie', 'actor')),
+    entity_id INT NOT NULL,
+    version INT NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore', 'revert', 'merge')),
+    snapshot JSONB NOT NULL,
+    changes JSONB NOT NULL DEFAULT '{}',
+    changed_by VARCHAR(50) NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE revisions OWNER TO postgres;
+
+-- Append-only record of every request that changed data and of authentications,
+-- failed ones rate-limited per source address and successful ones once an hour
+-- per user and address.
+CREATE TABLE IF NOT EXISTS audit_log (
+    audit_id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    principal VARCHAR(50) NOT NULL,
+    action VARCHAR(100) NOT NULL,
+    resource_type VARCHAR(50) NOT NULL,
+    resource_id VARCHAR(100) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(200) NOT NULL,
+    request_id VARCHAR(100) NOT NULL,
+    source_ip VARCHAR(45) NOT NULL,
+    outcome VARCHAR(10) NOT NULL CHECK (outcome IN ('success', 'failure')),
+    status INT NOT NULL
+);
+
+ALTER TABLE audit_log OWNER TO postgres;
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TABLE IF NOT EXISTS people (
+    person_id SERIAL PRIMARY KEY,
+    name VARCHAR(150) NOT NULL,
+    date_of_birth DATE
+);
+
+ALTER TABLE people OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS movies_crew (
+    movie_id INT REFERENCES movies(movie_id),
+    person_id INT REFERENCES people(person_id),
+    role VARCHAR(30) NOT NULL CHECK (role IN ('director', 'writer', 'producer', 'composer', 'cinematographer')),
+    PRIMARY KEY (movie_id, person_id, role)
+);
+
+ALTER TABLE movies_crew OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS genres (
+    genre_id SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL
+);
+
+ALTER TABLE genres OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS movies_genres (
+    movie_id INT REFERENCES movies(movie_id),
+    genre_id INT REFERENCES genres(genre_id),
+    PRIMARY KEY (movie_id, genre_id)
+);
+
+ALTER TABLE movies_genres OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS movie_tags (
+    movie_id INT REFERENCES movies(movie_id),
+    tag VARCHAR(50) NOT NULL,
+    PRIMARY KEY (movie_id, tag)
+);
+
+ALTER TABLE movie_tags OWNER TO postgres;
+
+CREATE INDEX movie_name_index ON movies(name);
+CREATE INDEX actor_name_index ON actors(name);
+CREATE INDEX person_name_index ON people(name);
+CREATE INDEX movies_crew_person_index ON movies_crew(person_id);
+CREATE UNIQUE INDEX genre_name_index ON genres(lower(name));
+CREATE INDEX movies_genres_genre_index ON movies_genres(genre_id);
+CREATE INDEX movie_tags_tag_index ON movie_tags(tag);
+CREATE INDEX reviews_username_index ON reviews(username);
+CREATE INDEX collections_username_index ON collections(username);
+CREATE INDEX franchise_movies_franchise_index ON franchise_movies(franchise_id, position);
+CREATE INDEX movie_relations_related_index ON movie_relations(related_movie_id);
+CREATE INDEX series_name_index ON series(name);
+CREATE INDEX episodes_actors_actor_index ON episodes_actors(actor_id);
+CREATE INDEX movie_translations_name_index ON movie_translations(name);
+CREATE INDEX actor_translations_name_index ON actor_translations(name);
+CREATE INDEX actor_aliases_name_index ON actor_aliases(name);
+CREATE INDEX actor_merges_source_index ON actor_merges(source_actor_id);
+CREATE INDEX movies_deleted_at_index ON movies(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX actors_deleted_at_index ON actors(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX revisions_entity_index ON revisions(entity_type, entity_id, revision_id);
+CREATE INDEX audit_log_occurred_at_index ON audit_log(occurred_at);
+CREATE INDEX audit_log_principal_index ON audit_log(principal);
+CREATE INDEX audit_log_resource_index ON audit_log(resource_type, resource_id);
@@ -1,10 +1,15 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"movieLibrary/internal/config"
 	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/validation"
 	"net/http"
 	"strconv"
 	"strings"
@@ -25,41 +30,117 @@ func createActorHandler(db *sql.DB) http.HandlerFunc {
 		var actorReq ActorRequest
 		if err := json.NewDecoder(r.Body).Decode(&actorReq); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
-			helpers2.ErrorLogger.Println("Error decoding actor request on creating:", err)
+			slog.ErrorContext(r.Context(), "Error decoding actor request on creating", "error", err)
 			return
 		}
+		if !validation.Name(actorReq.Name) {
+			http.Error(w, "Invalid actor name", http.StatusBadRequest)
+			return
+		}
+
+		var actor ActorResponse
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			actorID, err := insertActor(r.Context(), tx, actorReq)
+			if err != nil {
+				return err
+			}
+			actor, err = fetchActor(r.Context(), tx, actorID)
+			return err
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error creating actor", "error", err)
+			return
+		}
+
+		w.Header().Set("Location", actorLocation(actor.ID))
+		w.Header().Set("ETag", versionETag(actor.Version))
+		if err := writeJSON(w, http.StatusCreated, actor); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding created actor", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to create actor")
+	}
+}
+
+func bulkCreateActorsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var actorReqs []ActorRequest
+		if err := json.NewDecoder(r.Body).Decode(&actorReqs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding actor request on bulk creating", "error", err)
+			return
+		}
+		if len(actorReqs) == 0 {
+			http.Error(w, "Empty request body", http.StatusBadRequest)
+			return
+		}
+		for i, actorReq := range actorReqs {
+			if !validation.Name(actorReq.Name) {
+				http.Error(w, fmt.Sprintf("Invalid actor name at index %d", i), http.StatusBadRequest)
+				return
+			}
+		}
 
-		_, err := db.Exec("INSERT INTO actors (name, sex, date_of_birth) VALUES ($1, $2, $3)",
-			actorReq.Name, actorReq.Sex, actorReq.DateOfBirth)
+		actors := make([]ActorResponse, 0, len(actorReqs))
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			for _, actorReq := range actorReqs {
+				actorID, err := insertActor(r.Context(), tx, actorReq)
+				if err != nil {
+					return err
+				}
+				actor, err := fetchActor(r.Context(), tx, actorID)
+				if err != nil {
+					return err
+				}
+				actors = append(actors, actor)
+			}
+			return nil
+		})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error executing SQL query on creating actor:", err)
+			slog.ErrorContext(r.Context(), "Error bulk creating actors", "error", err)
 			return
 		}
 
-		w.WriteHeader(http.StatusCreated)
+		if err := writeJSON(w, http.StatusCreated, actors); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding created actors", "error", err)
+		}
 
-		log.Println("Received request to create actor")
+		slog.DebugContext(r.Context(), "Received request to bulk create actors", "count", len(actors))
 	}
 }
 
-func updateActorHandler(db *sql.DB) http.HandlerFunc {
+func updateActorHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
+		actorID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		var actorReq ActorRequest
 		if err := json.NewDecoder(r.Body).Decode(&actorReq); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
-			helpers2.ErrorLogger.Println("Error decoding actor request on updating:", err)
+			slog.ErrorContext(r.Context(), "Error decoding actor request on updating", "error", err)
 			return
 		}
 
 		var queryArgs []interface{}
-		updateQuery := "UPDATE actors SET"
+		updateQuery := "UPDATE actors SET version=version+1, updated_at=now(),"
 		pIndex := 1
 		if actorReq.Name != "" {
+			if !validation.Name(actorReq.Name) {
+				http.Error(w, "Invalid actor name", http.StatusBadRequest)
+				return
+			}
 			updateQuery += " name=$" + strconv.Itoa(pIndex) + ","
 			queryArgs = append(queryArgs, actorReq.Name)
 			pIndex++
@@ -76,82 +157,404 @@ func updateActorHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		updateQuery = strings.TrimSuffix(updateQuery, ",") + " WHERE actor_id=$" + strconv.Itoa(pIndex)
-		queryArgs = append(queryArgs, r.URL.Query().Get("id"))
+		queryArgs = append(queryArgs, actorID)
 
-		_, err := db.Exec(updateQuery, queryArgs...)
+		var actor ActorResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			version, err := lockActor(r.Context(), tx, actorID)
+			if err != nil {
+				return err
+			}
+			if err := checkIfMatch(r, cfg.RequireIfMatch, version); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(r.Context(), updateQuery, queryArgs...); err != nil {
+				return fmt.Errorf("updating actor: %w", err)
+			}
+			if err := recordRevision(r.Context(), tx, actorEntity, actorID, "update"); err != nil {
+				return err
+			}
+			actor, err = fetchActor(r.Context(), tx, actorID)
+			return err
+		})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error executing SQL query on updating actor:", err)
+			writeError(w, r, err, "Error executing SQL query on updating actor:")
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		w.Header().Set("ETag", versionETag(actor.Version))
+		if err := writeJSON(w, http.StatusOK, actor); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding updated actor", "error", err)
+		}
 
-		log.Println("Received request to update actor")
+		slog.DebugContext(r.Context(), "Received request to update actor")
 	}
 }
 
-func deleteActorHandler(db *sql.DB) http.HandlerFunc {
+func patchActorHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
-		_, err := db.Exec("DELETE FROM actors WHERE actor_id=$1", r.URL.Query().Get("id"))
+		actorID, err := idFromQuery(r, "id")
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error executing SQL query on deleting actor:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mediaType, body, err := readPatchBody(r)
+		if err != nil {
+			writeError(w, r, err, "Error reading actor patch:")
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		var actor ActorResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			version, err := lockActor(r.Context(), tx, actorID)
+			if err != nil {
+				return err
+			}
+			if err := checkIfMatch(r, cfg.RequireIfMatch, version); err != nil {
+				return err
+			}
+			current, err := loadActorDocument(r.Context(), tx, actorID)
+			if err != nil {
+				return err
+			}
+			var patched actorDocument
+			if err := applyPatch(mediaType, body, current, &patched); err != nil {
+				return err
+			}
+			if err := patched.validate(); err != nil {
+				return err
+			}
+			if err := storeActorDocument(r.Context(), tx, actorID, patched); err != nil {
+				return err
+			}
+			if err := recordRevision(r.Context(), tx, actorEntity, actorID, "update"); err != nil {
+				return err
+			}
+			actor, err = fetchActor(r.Context(), tx, actorID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error patching actor:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(actor.Version))
+		if err := writeJSON(w, http.StatusOK, actor); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding patched actor", "error", err)
+		}
 
-		log.Println("Received request to delete actor")
+		slog.DebugContext(r.Context(), "Received request to patch actor")
 	}
 }
 
-func getActorsHandler(db *sql.DB) http.HandlerFunc {
+// deleteActorHandler moves the actor to the trash. Credits are kept so that
+// restoring the actor brings them back.
+func deleteActorHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := db.Query(`SELECT a.actor_id, a.name, a.sex, a.date_of_birth,
-       			array_to_json(array_agg(m.name))
-			FROM actors a 
-			JOIN movies_actors ma ON a.actor_id = ma.actor_id
-    		JOIN movies m ON ma.movie_id = m.movie_id
-			GROUP BY a.actor_id`)
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		actorID, err := idFromQuery(r, "id")
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error executing SQL query on reading actors:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		defer rows.Close()
 
-		var actors []ActorResponse
-		for rows.Next() {
-			var actor ActorResponse
-			var moviesJSON []byte
-			if err := rows.Scan(&actor.ID, &actor.Name, &actor.Sex, &actor.DateOfBirth, &moviesJSON); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				helpers2.ErrorLogger.Println("Error scanning rows:", err)
-				return
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			version, err := lockActor(r.Context(), tx, actorID)
+			if err != nil {
+				return err
 			}
-			var movies []string
-			if err := json.Unmarshal(moviesJSON, &movies); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				helpers2.ErrorLogger.Println("Error unmarshalling movies JSON:", err)
-				return
+			if err := checkIfMatch(r, cfg.RequireIfMatch, version); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(r.Context(), `UPDATE actors SET deleted_at=now(), version=version+1, updated_at=now()
+				WHERE actor_id=$1`, actorID)
+			if err != nil {
+				return err
 			}
+			if err := recordRevision(r.Context(), tx, actorEntity, actorID, "delete"); err != nil {
+				return err
+			}
+			return touchActorMovies(r.Context(), tx, actorID)
+		})
+		if err != nil {
+			writeError(w, r, err, "Error executing SQL query on deleting actor:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
 
-			actor.Movies = movies
-			actors = append(actors, actor)
+		slog.DebugContext(r.Context(), "Received request to delete actor")
+	}
+}
+
+func getActorHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actorID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		actor, err := fetchActor(r.Context(), db, actorID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Actors merged into another one redirect to the survivor.
+			survivorID, merged, mergeErr := mergedActorSurvivor(r.Context(), db, actorID)
+			if mergeErr != nil {
+				err = mergeErr
+			} else if merged {
+				query := r.URL.Query()
+				query.Set("id", strconv.Itoa(survivorID))
+				http.Redirect(w, r, r.URL.Path+"?"+query.Encode(), http.StatusMovedPermanently)
+				return
+			}
 		}
+		if err != nil {
+			writeError(w, r, err, "Error executing SQL query on reading actor:")
+			return
+		}
+		actors := []ActorResponse{actor}
+		if err := localizeActors(r.Context(), db, requestLanguages(r), actors); err != nil {
+			writeError(w, r, err, "Error translating actor:")
+			return
+		}
+		actor = actors[0]
+		setLanguageHeaders(w, actor.Language)
+		if err := writeJSONWithETag(w, r, actor); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding actor response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get actor")
+	}
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(actors); err != nil {
+func getActorsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var filter sqlFilter
+		filter.where("a.deleted_at IS NULL")
+		if name := r.URL.Query().Get("name"); name != "" {
+			filter.where(actorNameMatches(filter.arg(name)))
+		}
+		actors, err := queryActors(r.Context(), db, `SELECT `+actorColumns+` FROM actors a`+filter.clause()+` ORDER BY a.actor_id`,
+			filter.args...)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error encoding actors response:", err)
+			slog.ErrorContext(r.Context(), "Error executing SQL query on reading actors", "error", err)
+			return
+		}
+		if err := localizeActors(r.Context(), db, requestLanguages(r), actors); err != nil {
+			writeError(w, r, err, "Error translating actors:")
 			return
 		}
+		setLanguageHeaders(w, "")
+
+		if err := writeJSONWithETag(w, r, actors); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding actors response", "error", err)
+		}
 
-		log.Println("Received request to get actors")
+		slog.DebugContext(r.Context(), "Received request to get actors")
+	}
+}
+
+func actorLocation(actorID int) string {
+	return "/actors/get?id=" + strconv.Itoa(actorID)
+}
+
+// insertActor stores a new actor, records its first revision and returns the
+// generated ID.
+func insertActor(ctx context.Context, tx *sql.Tx, actorReq ActorRequest) (int, error) {
+	var actorID int
+	err := tx.QueryRowContext(ctx, `INSERT INTO actors (name, sex, date_of_birth)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, '')::date) RETURNING actor_id`,
+		actorReq.Name, actorReq.Sex, actorReq.DateOfBirth).Scan(&actorID)
+	if err != nil {
+		return 0, fmt.Errorf("inserting actor: %w", err)
+	}
+	if err := recordRevision(ctx, tx, actorEntity, actorID, "create"); err != nil {
+		return 0, err
+	}
+	return actorID, nil
+}
+
+// actorColumns is the select list, over actors aliased as a, shared by every
+// query that is scanned with scanActor.
+const actorColumns = `a.actor_id, a.name, COALESCE(a.sex, ''),
+	COALESCE(to_char(a.date_of_birth, 'YYYY-MM-DD'), ''),
+	COALESCE((
+		SELECT array_to_json(array_agg(m.name ORDER BY m.name))
+		FROM movies m
+		JOIN movies_actors ma ON m.movie_id = ma.movie_id
+		WHERE ma.actor_id = a.actor_id AND m.deleted_at IS NULL
+	), '[]'),
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'movie_id', m.movie_id,
+			'name', m.name,
+			'release_date', to_char(m.release_date, 'YYYY-MM-DD'),
+			'characters', ma.characters,
+			'billing_order', ma.billing_order,
+			'credit_type', ma.credit_type
+		) ORDER BY m.release_date NULLS LAST, m.name)
+		FROM movies m
+		JOIN movies_actors ma ON m.movie_id = ma.movie_id
+		WHERE ma.actor_id = a.actor_id AND m.deleted_at IS NULL
+	), '[]'),
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'id', aa.alias_id,
+			'name', aa.name,
+			'kind', aa.kind
+		) ORDER BY aa.name)
+		FROM actor_aliases aa
+		WHERE aa.actor_id = a.actor_id
+	), '[]'),
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'kind', i.kind,
+			'key', i.storage_key,
+			'content_type', i.content_type,
+			'width', i.width,
+			'height', i.height
+		))
+		FROM images i
+		WHERE i.actor_id = a.actor_id
+	), '[]'),
+	a.version, a.updated_at`
+
+func scanActor(row rowScanner) (ActorResponse, error) {
+	var actor ActorResponse
+	var moviesJSON, filmographyJSON, aliasesJSON, imagesJSON []byte
+	err := row.Scan(&actor.ID, &actor.Name, &actor.Sex, &actor.DateOfBirth, &moviesJSON, &filmographyJSON,
+		&aliasesJSON, &imagesJSON, &actor.Version, &actor.UpdatedAt)
+	if err != nil {
+		return actor, err
+	}
+	if err := json.Unmarshal(moviesJSON, &actor.Movies); err != nil {
+		return actor, fmt.Errorf("unmarshalling movies JSON: %w", err)
+	}
+	if err := json.Unmarshal(filmographyJSON, &actor.Filmography); err != nil {
+		return actor, fmt.Errorf("unmarshalling filmography JSON: %w", err)
+	}
+	if err := json.Unmarshal(aliasesJSON, &actor.Aliases); err != nil {
+		return actor, fmt.Errorf("unmarshalling aliases JSON: %w", err)
+	}
+	images, err := imagesByKind(imagesJSON)
+	if err != nil {
+		return actor, err
+	}
+	actor.Photo = images["photo"]
+	return actor, nil
+}
+
+func queryActors(ctx context.Context, q queryer, query string, args ...interface{}) ([]ActorResponse, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actors := []ActorResponse{}
+	for rows.Next() {
+		actor, err := scanActor(rows)
+		if err != nil {
+			return nil, err
+		}
+		actors = append(actors, actor)
+	}
+	return actors, rows.Err()
+}
+
+// fetchActor reads the persisted representation of a single actor.
+func fetchActor(ctx context.Context, q queryer, actorID int) (ActorResponse, error) {
+	return scanActor(q.QueryRowContext(ctx, `SELECT `+actorColumns+` FROM actors a
+		WHERE a.actor_id = $1 AND a.deleted_at IS NULL`, actorID))
+}
+
+// lockActor locks the actor row for the rest of the transaction and returns its version.
+func lockActor(ctx context.Context, tx *sql.Tx, actorID int) (int, error) {
+	var version int
+	err := tx.QueryRowContext(ctx, "SELECT version FROM actors WHERE actor_id = $1 AND deleted_at IS NULL FOR UPDATE",
+		actorID).Scan(&version)
+	return version, err
+}
+
+// editActor runs edit in a transaction after checking the If-Match
+// precondition, bumps the actor version and returns the updated actor.
+func editActor(r *http.Request, db *sql.DB, cfg config.Config, actorID int, edit func(tx *sql.Tx) error) (ActorResponse, error) {
+	var actor ActorResponse
+	err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+		version, err := lockActor(r.Context(), tx, actorID)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(r, cfg.RequireIfMatch, version); err != nil {
+			return err
+		}
+		if err := edit(tx); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(r.Context(), "UPDATE actors SET version=version+1, updated_at=now() WHERE actor_id=$1", actorID)
+		if err != nil {
+			return fmt.Errorf("updating actor version: %w", err)
+		}
+		if err := recordRevision(r.Context(), tx, actorEntity, actorID, "update"); err != nil {
+			return err
+		}
+		actor, err = fetchActor(r.Context(), tx, actorID)
+		return err
+	})
+	return actor, err
+}
+
+// actorDocument is the representation of an actor that PATCH requests operate
+// on. Nil fields are stored as NULL.
+type actorDocument struct {
+	Name        *string `json:"name"`
+	Sex         *string `json:"sex"`
+	DateOfBirth *string `json:"date_of_birth"`
+}
+
+func (d actorDocument) validate() error {
+	if d.Name == nil || !validation.Name(*d.Name) {
+		return newStatusError(http.StatusUnprocessableEntity, "Invalid actor name")
+	}
+	if d.DateOfBirth != nil && !validation.Date(*d.DateOfBirth) {
+		return newStatusError(http.StatusUnprocessableEntity, "Invalid actor date of birth")
+	}
+	return nil
+}
+
+// storeActorDocument writes a validated actor document and bumps the actor version.
+func storeActorDocument(ctx context.Context, tx *sql.Tx, actorID int, doc actorDocument) error {
+	_, err := tx.ExecContext(ctx, `UPDATE actors SET name=$1, sex=$2, date_of_birth=$3, version=version+1, updated_at=now()
+		WHERE actor_id=$4`,
+		doc.Name, doc.Sex, doc.DateOfBirth, actorID)
+	if err != nil {
+		return fmt.Errorf("updating actor: %w", err)
+	}
+	return nil
+}
+
+func loadActorDocument(ctx context.Context, tx *sql.Tx, actorID int) (actorDocument, error) {
+	var doc actorDocument
+	var name string
+	var sex, dateOfBirth sql.NullString
+	err := tx.QueryRowContext(ctx, `SELECT name, sex, to_char(date_of_birth, 'YYYY-MM-DD')
+		FROM actors WHERE actor_id = $1`, actorID).Scan(&name, &sex, &dateOfBirth)
+	if err != nil {
+		return doc, err
+	}
+	doc.Name = &name
+	if sex.Valid {
+		doc.Sex = &sex.String
+	}
+	if dateOfBirth.Valid {
+		doc.DateOfBirth = &dateOfBirth.String
 	}
+	return doc, nil
 }
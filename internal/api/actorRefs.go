@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"movieLibrary/internal/pkg/validation"
+	"net/http"
+)
+
+// ActorRef identifies an actor in movie requests. It is decoded from a JSON
+// number (actor ID), a string (actor name) or an object with id or name.
+type ActorRef struct {
+	ID   int    `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+func (ref *ActorRef) UnmarshalJSON(data []byte) error {
+	var id int
+	if err := json.Unmarshal(data, &id); err == nil {
+		*ref = ActorRef{ID: id}
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*ref = ActorRef{Name: name}
+		return nil
+	}
+	type plainActorRef ActorRef
+	var obj plainActorRef
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("actor reference must be an ID, a name or an object with id or name: %w", err)
+	}
+	*ref = ActorRef(obj)
+	return nil
+}
+
+func (ref ActorRef) valid() bool {
+	return ref.ID > 0 || validation.Name(ref.Name)
+}
+
+// resolveActorRefs maps actor references to actor IDs. References by name
+// must match exactly one actor; unknown names are created when createMissing
+// is set, once per name even if it is repeated. All problems are collected
+// and reported together as a 422.
+func resolveActorRefs(ctx context.Context, tx *sql.Tx, refs []ActorRef, createMissing bool) ([]int, error) {
+	unresolved := UnresolvedActorsResponse{Error: "Some actors could not be resolved"}
+	actorIDs := make([]int, len(refs))
+	created := map[string]int{}
+	for i, ref := range refs {
+		if ref.ID > 0 {
+			var exists bool
+			err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM actors WHERE actor_id = $1 AND deleted_at IS NULL)", ref.ID).Scan(&exists)
+			if err != nil {
+				return nil, fmt.Errorf("checking actor %d: %w", ref.ID, err)
+			}
+			if !exists {
+				unresolved.UnknownIDs = append(unresolved.UnknownIDs, ref.ID)
+			}
+			actorIDs[i] = ref.ID
+			continue
+		}
+
+		if actorID, ok := created[ref.Name]; ok {
+			actorIDs[i] = actorID
+			continue
+		}
+		candidates, err := actorsNamed(ctx, tx, ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(candidates) == 1:
+			actorIDs[i] = candidates[0].ID
+		case len(candidates) > 1:
+			unresolved.Ambiguous = append(unresolved.Ambiguous, AmbiguousActor{Name: ref.Name, Candidates: candidates})
+		case createMissing:
+			actorID, err := insertActor(ctx, tx, ActorRequest{Name: ref.Name})
+			if err != nil {
+				return nil, err
+			}
+			created[ref.Name] = actorID
+			actorIDs[i] = actorID
+		default:
+			unresolved.UnknownNames = append(unresolved.UnknownNames, ref.Name)
+		}
+	}
+
+	if len(unresolved.UnknownIDs) != 0 || len(unresolved.UnknownNames) != 0 || len(unresolved.Ambiguous) != 0 {
+		return nil, &statusError{status: http.StatusUnprocessableEntity, message: unresolved.Error, details: unresolved}
+	}
+	return actorIDs, nil
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"movieLibrary/internal/config"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/validation"
+	"net/http"
+)
+
+// ActorAliasRequest adds another name an actor is known by. Kind defaults to
+// "other".
+type ActorAliasRequest struct {
+	Name string `json:"name"`
+	Kind string `json:"kind,omitempty"`
+}
+
+func getActorAliasesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actorID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		actor, err := fetchActor(r.Context(), db, actorID)
+		if err != nil {
+			writeError(w, r, err, "Error getting actor aliases from database:")
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, actor.Aliases); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding actor aliases", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get actor aliases")
+	}
+}
+
+func addActorAliasHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		actorID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var aliasReq ActorAliasRequest
+		if err := json.NewDecoder(r.Body).Decode(&aliasReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding actor alias request", "error", err)
+			return
+		}
+		if aliasReq.Kind == "" {
+			aliasReq.Kind = "other"
+		}
+		if !validation.Name(aliasReq.Name) || !validation.AliasKind(aliasReq.Kind) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		actor, err := editActor(r, db, cfg, actorID, func(tx *sql.Tx) error {
+			var exists bool
+			err := tx.QueryRowContext(r.Context(), `SELECT EXISTS(
+					SELECT 1 FROM actors WHERE actor_id = $1 AND name = $2
+					UNION ALL
+					SELECT 1 FROM actor_aliases WHERE actor_id = $1 AND name = $2
+				)`, actorID, aliasReq.Name).Scan(&exists)
+			if err != nil {
+				return fmt.Errorf("checking actor alias: %w", err)
+			}
+			if exists {
+				return newStatusError(http.StatusConflict, "actor is already known as %q", aliasReq.Name)
+			}
+			_, err = tx.ExecContext(r.Context(), "INSERT INTO actor_aliases (actor_id, name, kind) VALUES ($1, $2, $3)",
+				actorID, aliasReq.Name, aliasReq.Kind)
+			if err != nil {
+				return fmt.Errorf("inserting actor alias: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error adding actor alias:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(actor.Version))
+		if err := writeJSON(w, http.StatusOK, actor); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding actor response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to add actor alias")
+	}
+}
+
+func removeActorAliasHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		actorID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		aliasID, err := idFromQuery(r, "alias_id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		actor, err := editActor(r, db, cfg, actorID, func(tx *sql.Tx) error {
+			result, err := tx.ExecContext(r.Context(), "DELETE FROM actor_aliases WHERE alias_id = $1 AND actor_id = $2",
+				aliasID, actorID)
+			if err != nil {
+				return fmt.Errorf("deleting actor alias: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error removing actor alias:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(actor.Version))
+		if err := writeJSON(w, http.StatusOK, actor); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding actor response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to remove actor alias")
+	}
+}
+
+// actorNameMatches is a condition on actors aliased as a that holds when the
+// actor's name, one of its aliases or one of its translated names contains
+// the search text bound to the placeholder pattern.
+func actorNameMatches(pattern string) string {
+	return `(a.name ILIKE '%' || ` + pattern + ` || '%' OR
+		EXISTS(
+			SELECT 1
+			FROM actor_aliases aa
+			WHERE aa.actor_id = a.actor_id AND aa.name ILIKE '%' || ` + pattern + ` || '%'
+		) OR
+		EXISTS(
+			SELECT 1
+			FROM actor_translations at
+			WHERE at.actor_id = a.actor_id AND at.name ILIKE '%' || ` + pattern + ` || '%'
+		))`
+}
+
+// actorsNamed finds the actors an exact name refers to. Primary names win;
+// only when no actor is primarily called name are aliases and translated
+// names considered.
+func actorsNamed(ctx context.Context, tx *sql.Tx, name string) ([]ActorCandidate, error) {
+	candidates, err := actorCandidates(ctx, tx, `SELECT actor_id, name, COALESCE(to_char(date_of_birth, 'YYYY-MM-DD'), '')
+		FROM actors WHERE name = $1 AND deleted_at IS NULL ORDER BY actor_id`, name)
+	if err != nil || len(candidates) > 0 {
+		return candidates, err
+	}
+	return actorCandidates(ctx, tx, `SELECT a.actor_id, a.name, COALESCE(to_char(a.date_of_birth, 'YYYY-MM-DD'), '')
+		FROM actors a
+		WHERE a.deleted_at IS NULL AND (
+			EXISTS(SELECT 1 FROM actor_aliases aa WHERE aa.actor_id = a.actor_id AND aa.name = $1) OR
+			EXISTS(SELECT 1 FROM actor_translations at WHERE at.actor_id = a.actor_id AND at.name = $1))
+		ORDER BY a.actor_id`, name)
+}
+
+func actorCandidates(ctx context.Context, tx *sql.Tx, query string, name string) ([]ActorCandidate, error) {
+	rows, err := tx.QueryContext(ctx, query, name)
+	if err != nil {
+		return nil, fmt.Errorf("looking up actor %q: %w", name, err)
+	}
+	defer rows.Close()
+
+	var candidates []ActorCandidate
+	for rows.Next() {
+		var candidate ActorCandidate
+		if err := rows.Scan(&candidate.ID, &candidate.Name, &candidate.DateOfBirth); err != nil {
+			return nil, fmt.Errorf("scanning actor %q: %w", name, err)
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, rows.Err()
+}
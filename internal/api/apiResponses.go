@@ -1,18 +1,372 @@
 package api
 
+import "encoding/json"
+
 type ActorResponse struct {
-	ID          int      `json:"id"`
-	Name        string   `json:"name"`
-	Sex         string   `json:"sex"`
-	DateOfBirth string   `json:"date_of_birth"`
-	Movies      []string `json:"movies"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Sex         string `json:"sex"`
+	DateOfBirth string `json:"date_of_birth"`
+	// Language is the language of the translated name, empty for the original.
+	Language    string                     `json:"language,omitempty"`
+	Aliases     []ActorAliasResponse       `json:"aliases"`
+	Photo       *ImageResponse             `json:"photo"`
+	Movies      []string                   `json:"movies"`
+	Filmography []FilmographyEntryResponse `json:"filmography"`
+	Version     int                        `json:"version"`
+	UpdatedAt   string                     `json:"updated_at"`
+}
+
+type ActorAliasResponse struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+type FilmographyEntryResponse struct {
+	MovieID      int      `json:"movie_id"`
+	Name         string   `json:"name"`
+	ReleaseDate  string   `json:"release_date,omitempty"`
+	Characters   []string `json:"characters"`
+	BillingOrder int      `json:"billing_order,omitempty"`
+	CreditType   string   `json:"credit_type,omitempty"`
 }
 
 type MovieResponse struct {
-	ID          int      `json:"id"`
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	ReleaseDate string   `json:"release_date"`
-	Rating      float64  `json:"rating"`
-	Actors      []string `json:"actors"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ReleaseDate string `json:"release_date"`
+	// Language is the language of the translated name and description, empty
+	// for the original.
+	Language string `json:"language,omitempty"`
+	// Rating is the average of the users' ratings; EditorialRating is the
+	// value entered by admins.
+	Rating          float64              `json:"rating"`
+	VoteCount       int                  `json:"vote_count"`
+	WeightedRating  float64              `json:"weighted_rating"`
+	EditorialRating float64              `json:"editorial_rating"`
+	Actors          []string             `json:"actors"`
+	Cast            []CastMemberResponse `json:"cast"`
+	Crew            []CrewMemberResponse `json:"crew"`
+	Genres          []string             `json:"genres"`
+	Tags            []string             `json:"tags"`
+
+	RuntimeMinutes   int               `json:"runtime_minutes,omitempty"`
+	OriginalTitle    string            `json:"original_title,omitempty"`
+	OriginalLanguage string            `json:"original_language,omitempty"`
+	Countries        []string          `json:"countries"`
+	Certifications   map[string]string `json:"certifications"`
+	Budget           int64             `json:"budget,omitempty"`
+	BoxOffice        int64             `json:"box_office,omitempty"`
+	ImdbID           string            `json:"imdb_id,omitempty"`
+	TmdbID           int               `json:"tmdb_id,omitempty"`
+
+	Poster   *ImageResponse `json:"poster"`
+	Backdrop *ImageResponse `json:"backdrop"`
+
+	Franchise *MovieFranchiseResponse `json:"franchise"`
+	Relations []MovieRelationResponse `json:"relations"`
+
+	Version   int    `json:"version"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type CastMemberResponse struct {
+	ActorID      int      `json:"actor_id"`
+	Name         string   `json:"name"`
+	Characters   []string `json:"characters"`
+	BillingOrder int      `json:"billing_order,omitempty"`
+	CreditType   string   `json:"credit_type,omitempty"`
+}
+
+type UnresolvedActorsResponse struct {
+	Error        string           `json:"error"`
+	UnknownIDs   []int            `json:"unknown_ids,omitempty"`
+	UnknownNames []string         `json:"unknown_names,omitempty"`
+	Ambiguous    []AmbiguousActor `json:"ambiguous,omitempty"`
+}
+
+type AmbiguousActor struct {
+	Name       string           `json:"name"`
+	Candidates []ActorCandidate `json:"candidates"`
+}
+
+type ActorCandidate struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	DateOfBirth string `json:"date_of_birth,omitempty"`
+}
+
+type CrewMemberResponse struct {
+	PersonID int    `json:"person_id"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+}
+
+type PersonResponse struct {
+	ID          int                  `json:"id"`
+	Name        string               `json:"name"`
+	DateOfBirth string               `json:"date_of_birth"`
+	Credits     []CrewCreditResponse `json:"credits"`
+}
+
+type CrewCreditResponse struct {
+	MovieID int    `json:"movie_id"`
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+}
+
+type GenreResponse struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	MovieCount int    `json:"movie_count"`
+}
+
+type TagResponse struct {
+	Name       string `json:"name"`
+	MovieCount int    `json:"movie_count"`
+}
+
+type RatingResponse struct {
+	MovieID   int     `json:"movie_id"`
+	Username  string  `json:"username"`
+	Score     float64 `json:"score"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+type ReviewResponse struct {
+	ID       int      `json:"id"`
+	MovieID  int      `json:"movie_id"`
+	Username string   `json:"username"`
+	Title    string   `json:"title"`
+	Body     string   `json:"body"`
+	Spoiler  bool     `json:"spoiler"`
+	Rating   *float64 `json:"rating"`
+	// Hidden and ModerationReason are only shown to admins and the author.
+	Hidden           bool   `json:"hidden,omitempty"`
+	ModerationReason string `json:"moderation_reason,omitempty"`
+	CreatedAt        string `json:"created_at"`
+	UpdatedAt        string `json:"updated_at"`
+}
+
+type ReviewPageResponse struct {
+	Reviews  []ReviewResponse `json:"reviews"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"page_size"`
+	Total    int              `json:"total"`
+}
+
+type WatchlistEntryResponse struct {
+	Movie   MovieResponse `json:"movie"`
+	AddedAt string        `json:"added_at"`
+}
+
+type WatchedEntryResponse struct {
+	Movie        MovieResponse `json:"movie"`
+	WatchedOn    string        `json:"watched_on"`
+	RewatchCount int           `json:"rewatch_count"`
+}
+
+type CollectionResponse struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Public      bool   `json:"public"`
+	// URL is the path the collection can be shared by.
+	URL       string                    `json:"url"`
+	Entries   []CollectionEntryResponse `json:"entries"`
+	CreatedAt string                    `json:"created_at"`
+	UpdatedAt string                    `json:"updated_at"`
+}
+
+type CollectionEntryResponse struct {
+	Position    int    `json:"position"`
+	MovieID     int    `json:"movie_id"`
+	Name        string `json:"name"`
+	ReleaseDate string `json:"release_date"`
+	Note        string `json:"note,omitempty"`
+}
+
+type CollectionPageResponse struct {
+	Collections []CollectionResponse `json:"collections"`
+	Page        int                  `json:"page"`
+	PageSize    int                  `json:"page_size"`
+	Total       int                  `json:"total"`
+}
+
+type FranchiseResponse struct {
+	ID          int                      `json:"id"`
+	Name        string                   `json:"name"`
+	Description string                   `json:"description"`
+	Movies      []FranchiseEntryResponse `json:"movies"`
+}
+
+type FranchiseEntryResponse struct {
+	Position    int    `json:"position"`
+	MovieID     int    `json:"movie_id"`
+	Name        string `json:"name"`
+	ReleaseDate string `json:"release_date"`
+}
+
+// MovieFranchiseResponse places a movie within its franchise, with the
+// entries immediately before and after it.
+type MovieFranchiseResponse struct {
+	ID       int               `json:"id"`
+	Name     string            `json:"name"`
+	Position int               `json:"position"`
+	Previous *MovieRefResponse `json:"previous"`
+	Next     *MovieRefResponse `json:"next"`
+}
+
+type MovieRefResponse struct {
+	MovieID int    `json:"movie_id"`
+	Name    string `json:"name"`
+}
+
+// MovieRelationResponse describes what the related movie is to the movie
+// being shown: its sequel, prequel, remake or original.
+type MovieRelationResponse struct {
+	MovieID  int    `json:"movie_id"`
+	Name     string `json:"name"`
+	Relation string `json:"relation"`
+}
+
+type SeriesResponse struct {
+	ID           int                     `json:"id"`
+	Name         string                  `json:"name"`
+	Description  string                  `json:"description"`
+	FirstAirDate string                  `json:"first_air_date"`
+	LastAirDate  string                  `json:"last_air_date"`
+	Rating       float64                 `json:"rating"`
+	Seasons      []SeasonSummaryResponse `json:"seasons"`
+}
+
+type SeasonSummaryResponse struct {
+	ID           int    `json:"id"`
+	Number       int    `json:"number"`
+	Name         string `json:"name"`
+	EpisodeCount int    `json:"episode_count"`
+}
+
+type SeasonResponse struct {
+	ID          int                      `json:"id"`
+	SeriesID    int                      `json:"series_id"`
+	Number      int                      `json:"number"`
+	Name        string                   `json:"name"`
+	Description string                   `json:"description"`
+	Episodes    []EpisodeSummaryResponse `json:"episodes"`
+}
+
+type EpisodeSummaryResponse struct {
+	ID      int    `json:"id"`
+	Number  int    `json:"number"`
+	Name    string `json:"name"`
+	AirDate string `json:"air_date"`
+}
+
+type EpisodeResponse struct {
+	ID             int                 `json:"id"`
+	SeriesID       int                 `json:"series_id"`
+	SeasonID       int                 `json:"season_id"`
+	SeasonNumber   int                 `json:"season_number"`
+	Number         int                 `json:"number"`
+	Name           string              `json:"name"`
+	Description    string              `json:"description"`
+	AirDate        string              `json:"air_date"`
+	RuntimeMinutes int                 `json:"runtime_minutes,omitempty"`
+	Rating         float64             `json:"rating"`
+	GuestCast      []GuestCastResponse `json:"guest_cast"`
+}
+
+type GuestCastResponse struct {
+	ActorID    int      `json:"actor_id"`
+	Name       string   `json:"name"`
+	Characters []string `json:"characters"`
+}
+
+type TranslationResponse struct {
+	Language    string `json:"language"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// ImageResponse locates an uploaded image and its thumbnails, keyed by size.
+type ImageResponse struct {
+	URL         string            `json:"url"`
+	ContentType string            `json:"content_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Thumbnails  map[string]string `json:"thumbnails"`
+}
+
+type DuplicateActorsResponse struct {
+	// Reason is "same_name" or "similar_name_same_birth_date".
+	Reason string           `json:"reason"`
+	Actors []ActorCandidate `json:"actors"`
+}
+
+type ActorMergeResponse struct {
+	ID                int    `json:"id"`
+	SourceID          int    `json:"source_id"`
+	SourceName        string `json:"source_name"`
+	SourceDateOfBirth string `json:"source_date_of_birth,omitempty"`
+	TargetID          int    `json:"target_id"`
+	MovieIDs          []int  `json:"movie_ids"`
+	MergedBy          string `json:"merged_by"`
+	MergedAt          string `json:"merged_at"`
+}
+
+// TrashItemResponse is a deleted movie or actor waiting to be purged.
+type TrashItemResponse struct {
+	Type      string `json:"type"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt string `json:"deleted_at"`
+	PurgeAt   string `json:"purge_at"`
+}
+
+// RevisionResponse is one recorded change of a movie or actor. Snapshot holds
+// the state after the change; Changes the fields that differ from the
+// previous revision.
+type RevisionResponse struct {
+	ID         int                               `json:"id"`
+	EntityType string                            `json:"entity_type"`
+	EntityID   int                               `json:"entity_id"`
+	Version    int                               `json:"version"`
+	Action     string                            `json:"action"`
+	Snapshot   json.RawMessage                   `json:"snapshot"`
+	Changes    map[string]RevisionChangeResponse `json:"changes"`
+	ChangedBy  string                            `json:"changed_by"`
+	ChangedAt  string                            `json:"changed_at"`
+}
+
+type RevisionChangeResponse struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// AuditEntryResponse is one entry of the audit log. Action is derived from
+// the route, such as "movies.cast.add" or "auth.login".
+type AuditEntryResponse struct {
+	ID           int64  `json:"id"`
+	OccurredAt   string `json:"occurred_at"`
+	Principal    string `json:"principal"`
+	Action       string `json:"action"`
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	RequestID    string `json:"request_id"`
+	SourceIP     string `json:"source_ip"`
+	Outcome      string `json:"outcome"`
+	Status       int    `json:"status"`
+}
+
+type AuditPageResponse struct {
+	Entries  []AuditEntryResponse `json:"entries"`
+	Page     int                  `json:"page"`
+	PageSize int                  `json:"page_size"`
+	Total    int                  `json:"total"`
 }
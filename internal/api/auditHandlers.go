@@ -0,0 +1,340 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// auditedVerbs are the final path segments of routes that change data, which
+// are audited even when called with GET.
+var auditedVerbs = map[string]bool{
+	"create": true, "bulk": true, "update": true, "delete": true, "add": true, "remove": true, "order": true,
+	"hide": true, "unhide": true, "merge": true, "restore": true, "revert": true,
+}
+
+// methodVerbs names the action of routes that select it by method, such as
+// PUT /movies/rating.
+var methodVerbs = map[string]string{
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodPatch:  "update",
+	http.MethodDelete: "delete",
+}
+
+// Authentication is audited at a bounded rate, as it needs no credentials to
+// trigger: failures at most failedLoginAuditLimit times a minute per source
+// address, and successes once an hour per user and source address.
+const failedLoginAuditLimit = 10
+
+var (
+	failedLoginAudits     = newAuditLimiter(time.Minute, failedLoginAuditLimit)
+	successfulLoginAudits = newAuditLimiter(time.Hour, 1)
+)
+
+const auditColumns = `audit_id, occurred_at, principal, action, resource_type, resource_id, method, path, request_id,
+	source_ip, outcome, status`
+
+// auditEntry is a row of the append-only audit log.
+type auditEntry struct {
+	Principal    string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Status       int
+}
+
+// auditMiddleware records every request that changes data in the audit log
+// once next has handled it, successful or not.
+func auditMiddleware(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resourceType, action, mutating := auditAction(r)
+		if !mutating {
+			next(w, r)
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		resourceID := auditResourceID(r.URL.Query())
+		if resourceID == "" {
+			// Creates report the new resource in the Location header.
+			if location, err := url.Parse(w.Header().Get("Location")); err == nil {
+				resourceID = auditResourceID(location.Query())
+			}
+		}
+		recordAudit(r, db, auditEntry{
+			Principal:    helpers2.GetUsernameFromContext(r.Context()),
+			Action:       action,
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+			Status:       rec.status,
+		})
+	}
+}
+
+// auditAction derives the audited resource type and action from the request
+// path: POST /movies/cast/add is action "movies.cast.add" on "movies", and
+// PUT /movies/rating is "movies.rating.update". mutating reports whether the
+// request changes data.
+func auditAction(r *http.Request) (resourceType, action string, mutating bool) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	resourceType = segments[0]
+	last := segments[len(segments)-1]
+	switch {
+	case len(segments) > 1 && auditedVerbs[last]:
+		mutating = true
+	case methodVerbs[r.Method] != "":
+		segments = append(segments, methodVerbs[r.Method])
+		mutating = true
+	}
+	return resourceType, strings.Join(segments, "."), mutating
+}
+
+// auditResourceID returns the id parameter of query as the resource ID to
+// audit, normalized, or "" if it is not a valid ID.
+func auditResourceID(query url.Values) string {
+	id, err := strconv.Atoi(query.Get("id"))
+	if err != nil || id <= 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
+
+// recordAudit appends an entry to the audit log. The fields are cut to the
+// width of their columns, as most come from the client. Failures are logged
+// and counted rather than reported, as the request has already been answered.
+func recordAudit(r *http.Request, db *sql.DB, entry auditEntry) {
+	outcome := "success"
+	if entry.Status >= http.StatusBadRequest {
+		outcome = "failure"
+	}
+	// The entry is written even when the client has gone away.
+	ctx := context.WithoutCancel(r.Context())
+	_, err := db.ExecContext(ctx, `INSERT INTO audit_log (principal, action, resource_type, resource_id, method, path,
+			request_id, source_ip, outcome, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		auditField(entry.Principal, 50), auditField(entry.Action, 100), auditField(entry.ResourceType, 50),
+		auditField(entry.ResourceID, 100), auditField(r.Method, 10), auditField(r.URL.Path, 200),
+		auditField(helpers2.GetRequestIDFromContext(r.Context()), 100), auditField(sourceIP(r), 45),
+		outcome, entry.Status)
+	if err != nil {
+		auditWriteFailures.Inc()
+		slog.ErrorContext(r.Context(), "Error writing audit log", "error", err)
+	}
+}
+
+// auditField makes value fit a VARCHAR(length) column: invalid UTF-8 and NUL
+// bytes, which Postgres rejects, are replaced, and it is cut to length
+// characters.
+func auditField(value string, length int) string {
+	value = strings.ToValidUTF8(value, "\uFFFD")
+	value = strings.ReplaceAll(value, "\x00", "\uFFFD")
+	if utf8.RuneCountInString(value) <= length {
+		return value
+	}
+	return string([]rune(value)[:length])
+}
+
+// sourceIP returns the address the request came from, without its port.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// auditLimiter bounds how many audit entries each key, such as a source
+// address, may write in a window. Counts are kept for the current window only,
+// so its memory is bounded by the keys seen in one window.
+type auditLimiter struct {
+	mu      sync.Mutex
+	window  time.Duration
+	limit   int
+	started time.Time
+	counts  map[string]int
+}
+
+func newAuditLimiter(window time.Duration, limit int) *auditLimiter {
+	return &auditLimiter{window: window, limit: limit, counts: map[string]int{}}
+}
+
+// allow reports whether key may write another entry in the current window,
+// and counts it if so.
+func (l *auditLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now := time.Now(); now.Sub(l.started) >= l.window {
+		l.started = now
+		clear(l.counts)
+	}
+	if l.counts[key] >= l.limit {
+		return false
+	}
+	l.counts[key]++
+	return true
+}
+
+// getAuditLogHandler returns a page of the audit log, newest first.
+func getAuditLogHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		page, pageSize, err := pageFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var filter sqlFilter
+		if err := applyAuditFilters(r, &filter); err != nil {
+			writeError(w, r, err, "Error parsing audit log filters:")
+			return
+		}
+
+		auditPage := AuditPageResponse{Entries: []AuditEntryResponse{}, Page: page, PageSize: pageSize}
+		err = db.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM audit_log`+filter.clause(), filter.args...).
+			Scan(&auditPage.Total)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error counting audit log entries", "error", err)
+			return
+		}
+		limit, offset := filter.arg(pageSize), filter.arg((page-1)*pageSize)
+		rows, err := db.QueryContext(r.Context(), `SELECT `+auditColumns+` FROM audit_log`+filter.clause()+`
+			ORDER BY audit_id DESC LIMIT `+limit+` OFFSET `+offset, filter.args...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting audit log from database", "error", err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			entry, err := scanAuditEntry(rows)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Error scanning audit log", "error", err)
+				return
+			}
+			auditPage.Entries = append(auditPage.Entries, entry)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error reading audit log", "error", err)
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, auditPage); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding audit log response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get audit log")
+	}
+}
+
+// exportAuditLogHandler streams the matching audit log entries, oldest first,
+// as newline-delimited JSON.
+func exportAuditLogHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var filter sqlFilter
+		if err := applyAuditFilters(r, &filter); err != nil {
+			writeError(w, r, err, "Error parsing audit log filters:")
+			return
+		}
+
+		rows, err := db.QueryContext(r.Context(), `SELECT `+auditColumns+` FROM audit_log`+filter.clause()+`
+			ORDER BY audit_id`, filter.args...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting audit log from database", "error", err)
+			return
+		}
+		defer rows.Close()
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.ndjson"`)
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		for rows.Next() {
+			entry, err := scanAuditEntry(rows)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error scanning audit log", "error", err)
+				return
+			}
+			if err := encoder.Encode(entry); err != nil {
+				slog.ErrorContext(r.Context(), "Error encoding audit log export", "error", err)
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			slog.ErrorContext(r.Context(), "Error reading audit log", "error", err)
+			return
+		}
+
+		slog.DebugContext(r.Context(), "Received request to export audit log")
+	}
+}
+
+// applyAuditFilters adds the filter query parameters shared by /audit and
+// /audit/export.
+func applyAuditFilters(r *http.Request, f *sqlFilter) error {
+	query := r.URL.Query()
+	for param, column := range map[string]string{
+		"principal":     "principal",
+		"resource_type": "resource_type",
+		"resource_id":   "resource_id",
+		"request_id":    "request_id",
+		"source_ip":     "source_ip",
+	} {
+		if value := query.Get(param); value != "" {
+			f.where(column + " = " + f.arg(value))
+		}
+	}
+	if action := query.Get("action"); action != "" {
+		// A prefix such as "movies.cast" matches all cast actions.
+		f.where("(action = " + f.arg(action) + " OR action LIKE " + f.arg(action+".%") + ")")
+	}
+	if outcome := query.Get("outcome"); outcome != "" {
+		if outcome != "success" && outcome != "failure" {
+			return newStatusError(http.StatusBadRequest, "outcome must be success or failure")
+		}
+		f.where("outcome = " + f.arg(outcome))
+	}
+	for param, operator := range map[string]string{"from": ">=", "to": "<"} {
+		if value := query.Get(param); value != "" {
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return newStatusError(http.StatusBadRequest, "%s must be an RFC 3339 timestamp", param)
+			}
+			f.where("occurred_at " + operator + " " + f.arg(at))
+		}
+	}
+	return nil
+}
+
+func scanAuditEntry(row rowScanner) (AuditEntryResponse, error) {
+	var entry AuditEntryResponse
+	err := row.Scan(&entry.ID, &entry.OccurredAt, &entry.Principal, &entry.Action, &entry.ResourceType, &entry.ResourceID,
+		&entry.Method, &entry.Path, &entry.RequestID, &entry.SourceIP, &entry.Outcome, &entry.Status)
+	return entry, err
+}
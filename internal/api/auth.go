@@ -4,7 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/base64"
-	"movieLibrary/internal/pkg/helpers"
+	"log/slog"
 	"net/http"
 	"strings"
 )
@@ -14,26 +14,26 @@ func BasicAuthMiddleware(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
 		// Extract username and password from the Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			unauthorized(w, r, db, "", "missing")
 			return
 		}
 
 		auth := strings.SplitN(authHeader, " ", 2)
 		if len(auth) != 2 || auth[0] != "Basic" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			unauthorized(w, r, db, "", "malformed")
 			return
 		}
 
 		payload, err := base64.StdEncoding.DecodeString(auth[1])
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			helpers.ErrorLogger.Println("Error decoding payload on authentication:", err)
+			unauthorized(w, r, db, "", "malformed")
+			slog.ErrorContext(r.Context(), "Error decoding payload on authentication", "error", err)
 			return
 		}
 
 		pair := strings.SplitN(string(payload), ":", 2)
 		if len(pair) != 2 {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			unauthorized(w, r, db, "", "malformed")
 			return
 		}
 
@@ -43,19 +43,50 @@ func BasicAuthMiddleware(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
 		// Authenticate user and get their role
 		role, err := authenticateUser(db, username, password)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			helpers.ErrorLogger.Println("Error authenticating user:", err)
+			unauthorized(w, r, db, username, "invalid")
+			slog.ErrorContext(r.Context(), "Error authenticating user", "error", err)
 			return
 		}
 
-		// Set role in request context
+		// Set role and username in request context
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, "role", role)
+		ctx = context.WithValue(ctx, "username", username)
 		r = r.WithContext(ctx)
+		setPrincipal(w, username)
+		if successfulLoginAudits.allow(username + " " + sourceIP(r)) {
+			recordAudit(r, db, auditEntry{
+				Principal:    username,
+				Action:       "auth.login",
+				ResourceType: "users",
+				ResourceID:   username,
+				Status:       http.StatusOK,
+			})
+		}
+
+		// Call the next handler, auditing it if it changes data
+		auditMiddleware(db, next).ServeHTTP(w, r)
+	}
+}
 
-		// Call the next handler
-		next.ServeHTTP(w, r)
+// unauthorized rejects the request and records the failed authentication,
+// attempted by username if the credentials could be read, in the audit log,
+// unless its source address has already failed too often to be audited.
+// reason tells whether the credentials were missing, malformed or invalid.
+func unauthorized(w http.ResponseWriter, r *http.Request, db *sql.DB, username, reason string) {
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	authFailures.WithLabelValues(reason).Inc()
+	if !failedLoginAudits.allow(sourceIP(r)) {
+		auditSuppressed.Inc()
+		return
 	}
+	recordAudit(r, db, auditEntry{
+		Principal:    username,
+		Action:       "auth.login",
+		ResourceType: "users",
+		ResourceID:   username,
+		Status:       http.StatusUnauthorized,
+	})
 }
 
 // Authenticate user against the database and return their role
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log/slog"
+	"movieLibrary/internal/config"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"net/http"
+)
+
+type CastRequest struct {
+	ActorIDs []int `json:"actor_ids"`
+}
+
+// addMovieActorsHandler links actors to a movie. Actors that are already in
+// the cast are left untouched, so repeating the request is harmless and keeps
+// the movie version.
+func addMovieActorsHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var castReq CastRequest
+		if err := json.NewDecoder(r.Body).Decode(&castReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding cast request on adding actors", "error", err)
+			return
+		}
+		if len(castReq.ActorIDs) == 0 {
+			http.Error(w, "actor_ids must not be empty", http.StatusBadRequest)
+			return
+		}
+
+		movie, err := editMovie(r, db, cfg, movieID, func(tx *sql.Tx) error {
+			if err := ensureActorsExist(r.Context(), tx, castReq.ActorIDs); err != nil {
+				return err
+			}
+			var added int64
+			for _, actorID := range castReq.ActorIDs {
+				result, err := tx.ExecContext(r.Context(), `INSERT INTO movies_actors (movie_id, actor_id, billing_order)
+					SELECT $1, $2, COALESCE(MAX(billing_order), 0) + 1 FROM movies_actors WHERE movie_id = $1
+					ON CONFLICT (movie_id, actor_id) DO NOTHING`, movieID, actorID)
+				if err != nil {
+					return fmt.Errorf("inserting movie actor: %w", err)
+				}
+				inserted, err := result.RowsAffected()
+				if err != nil {
+					return fmt.Errorf("inserting movie actor: %w", err)
+				}
+				added += inserted
+			}
+			if added == 0 {
+				return errUnchanged
+			}
+			return renumberBilling(r.Context(), tx, movieID)
+		})
+		if err != nil {
+			writeError(w, r, err, "Error adding actors to movie:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(movie.Version))
+		if err := writeJSON(w, http.StatusOK, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movie response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to add actors to movie")
+	}
+}
+
+// removeMovieActorHandler unlinks an actor from a movie. Removing an actor
+// that is not in the cast succeeds without changes, keeping the movie version.
+func removeMovieActorHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		actorID, err := idFromQuery(r, "actor_id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		movie, err := editMovie(r, db, cfg, movieID, func(tx *sql.Tx) error {
+			result, err := tx.ExecContext(r.Context(), "DELETE FROM movies_actors WHERE movie_id = $1 AND actor_id = $2", movieID, actorID)
+			if err != nil {
+				return fmt.Errorf("deleting movie actor: %w", err)
+			}
+			if removed, err := result.RowsAffected(); err != nil {
+				return fmt.Errorf("deleting movie actor: %w", err)
+			} else if removed == 0 {
+				return errUnchanged
+			}
+			return renumberBilling(r.Context(), tx, movieID)
+		})
+		if err != nil {
+			writeError(w, r, err, "Error removing actor from movie:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(movie.Version))
+		if err := writeJSON(w, http.StatusOK, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movie response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to remove actor from movie")
+	}
+}
+
+// reorderMovieActorsHandler sets the billing order of the cast. The request
+// must list every actor of the movie exactly once, top-billed first.
+func reorderMovieActorsHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var castReq CastRequest
+		if err := json.NewDecoder(r.Body).Decode(&castReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding cast request on reordering actors", "error", err)
+			return
+		}
+
+		movie, err := editMovie(r, db, cfg, movieID, func(tx *sql.Tx) error {
+			cast, err := loadMovieCast(r.Context(), tx, movieID)
+			if err != nil {
+				return err
+			}
+			inCast := make(map[int]bool, len(cast))
+			for _, link := range cast {
+				inCast[link.ActorID] = true
+			}
+			if len(castReq.ActorIDs) != len(cast) {
+				return newStatusError(http.StatusUnprocessableEntity, "actor_ids must list all %d actors of the movie", len(cast))
+			}
+			var moved int64
+			for position, actorID := range castReq.ActorIDs {
+				if !inCast[actorID] {
+					return newStatusError(http.StatusUnprocessableEntity, "actor %d is not in the cast or is listed twice", actorID)
+				}
+				delete(inCast, actorID)
+				result, err := tx.ExecContext(r.Context(), `UPDATE movies_actors SET billing_order = $1
+					WHERE movie_id = $2 AND actor_id = $3 AND billing_order IS DISTINCT FROM $1`, position+1, movieID, actorID)
+				if err != nil {
+					return fmt.Errorf("updating billing order: %w", err)
+				}
+				updated, err := result.RowsAffected()
+				if err != nil {
+					return fmt.Errorf("updating billing order: %w", err)
+				}
+				moved += updated
+			}
+			if moved == 0 {
+				return errUnchanged
+			}
+			// Links to trashed actors go after the cast that was listed.
+			return renumberBilling(r.Context(), tx, movieID)
+		})
+		if err != nil {
+			writeError(w, r, err, "Error reordering movie actors:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(movie.Version))
+		if err := writeJSON(w, http.StatusOK, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movie response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to reorder movie actors")
+	}
+}
+
+// errUnchanged is returned by an edit passed to editMovie that found nothing
+// to change, such as adding an actor who is already in the cast.
+var errUnchanged = errors.New("unchanged")
+
+// editMovie runs edit in a transaction after checking the If-Match
+// precondition, bumps the movie version unless edit returned errUnchanged and
+// returns the updated movie.
+func editMovie(r *http.Request, db *sql.DB, cfg config.Config, movieID int, edit func(tx *sql.Tx) error) (MovieResponse, error) {
+	var movie MovieResponse
+	err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+		version, err := lockMovie(r.Context(), tx, movieID)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(r, cfg.RequireIfMatch, version); err != nil {
+			return err
+		}
+		if err := edit(tx); errors.Is(err, errUnchanged) {
+			movie, err = fetchMovie(r.Context(), tx, movieID)
+			return err
+		} else if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(r.Context(), "UPDATE movies SET version=version+1, updated_at=now() WHERE movie_id=$1", movieID)
+		if err != nil {
+			return fmt.Errorf("updating movie version: %w", err)
+		}
+		if err := recordRevision(r.Context(), tx, movieEntity, movieID, "update"); err != nil {
+			return err
+		}
+		movie, err = fetchMovie(r.Context(), tx, movieID)
+		return err
+	})
+	return movie, err
+}
+
+// touchMovies bumps the version of movies changed by an edit to another
+// resource, such as a related movie or their franchise, and records their
+// revisions. Trashed movies are left alone.
+func touchMovies(ctx context.Context, tx *sql.Tx, movieIDs []int64) error {
+	if len(movieIDs) == 0 {
+		return nil
+	}
+	var touched []int64
+	err := tx.QueryRowContext(ctx, `WITH touched AS (
+			UPDATE movies SET version=version+1, updated_at=now()
+			WHERE movie_id = ANY($1) AND deleted_at IS NULL
+			RETURNING movie_id
+		)
+		SELECT COALESCE(array_agg(movie_id ORDER BY movie_id), '{}') FROM touched`, pq.Array(movieIDs)).Scan(pq.Array(&touched))
+	if err != nil {
+		return fmt.Errorf("updating movie versions: %w", err)
+	}
+	return recordMovieRevisions(ctx, tx, touched)
+}
+
+func ensureActorsExist(ctx context.Context, q queryer, actorIDs []int) error {
+	rows, err := q.QueryContext(ctx, "SELECT actor_id FROM actors WHERE actor_id = ANY($1) AND deleted_at IS NULL", pq.Array(actorIDs))
+	if err != nil {
+		return fmt.Errorf("checking actors: %w", err)
+	}
+	defer rows.Close()
+
+	found := make(map[int]bool, len(actorIDs))
+	for rows.Next() {
+		var actorID int
+		if err := rows.Scan(&actorID); err != nil {
+			return fmt.Errorf("scanning actors: %w", err)
+		}
+		found[actorID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, actorID := range actorIDs {
+		if !found[actorID] {
+			return newStatusError(http.StatusUnprocessableEntity, "actor %d does not exist", actorID)
+		}
+	}
+	return nil
+}
+
+// renumberBilling closes the gaps left in the billing order after removals.
+// Links to trashed actors are numbered after the rest of the cast, so they
+// never share a position with an actor who is shown.
+func renumberBilling(ctx context.Context, tx *sql.Tx, movieID int) error {
+	_, err := tx.ExecContext(ctx, `UPDATE movies_actors ma SET billing_order = ordered.position
+		FROM (
+			SELECT l.actor_id,
+				row_number() OVER (ORDER BY a.deleted_at IS NOT NULL, l.billing_order NULLS LAST, l.actor_id) AS position
+			FROM movies_actors l JOIN actors a ON a.actor_id = l.actor_id
+			WHERE l.movie_id = $1
+		) ordered
+		WHERE ma.movie_id = $1 AND ma.actor_id = ordered.actor_id AND ma.billing_order IS DISTINCT FROM ordered.position`, movieID)
+	if err != nil {
+		return fmt.Errorf("renumbering billing order: %w", err)
+	}
+	return nil
+}
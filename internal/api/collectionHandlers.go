@@ -0,0 +1,514 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/validation"
+	"net/http"
+	"strconv"
+)
+
+// CollectionRequest is the body of collection create and update requests.
+// On update, omitted fields keep their current values.
+type CollectionRequest struct {
+	Name        string  `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Public      *bool   `json:"public,omitempty"`
+}
+
+// CollectionEntryRequest adds a movie to a collection, or updates its note
+// and position when it is already there. Position is 1-based and defaults to
+// the end for new entries and to the current position for existing ones.
+type CollectionEntryRequest struct {
+	MovieID  int    `json:"movie_id"`
+	Note     string `json:"note,omitempty"`
+	Position int    `json:"position,omitempty"`
+}
+
+type CollectionOrderRequest struct {
+	MovieIDs []int `json:"movie_ids"`
+}
+
+func createCollectionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var collectionReq CollectionRequest
+		if err := json.NewDecoder(r.Body).Decode(&collectionReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding collection request on creating", "error", err)
+			return
+		}
+		if !validation.Name(collectionReq.Name) || !validCollectionRequest(collectionReq) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var collection CollectionResponse
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			var collectionID int
+			err := tx.QueryRowContext(r.Context(), `INSERT INTO collections (username, name, description, public)
+				VALUES ($1, $2, NULLIF($3, ''), COALESCE($4, false)) RETURNING collection_id`,
+				helpers2.GetUsernameFromContext(r.Context()), collectionReq.Name, stringValue(collectionReq.Description),
+				collectionReq.Public).Scan(&collectionID)
+			if err != nil {
+				return fmt.Errorf("inserting collection: %w", err)
+			}
+			collection, err = fetchCollection(r.Context(), tx, collectionID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error creating collection:")
+			return
+		}
+
+		w.Header().Set("Location", collection.URL)
+		if err := writeJSON(w, http.StatusCreated, collection); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding created collection", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to create collection")
+	}
+}
+
+func updateCollectionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collectionID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var collectionReq CollectionRequest
+		if err := json.NewDecoder(r.Body).Decode(&collectionReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding collection request on updating", "error", err)
+			return
+		}
+		if (collectionReq.Name != "" && !validation.Name(collectionReq.Name)) || !validCollectionRequest(collectionReq) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		collection, err := editCollection(r, db, collectionID, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(r.Context(), `UPDATE collections SET
+					name = COALESCE(NULLIF($1, ''), name),
+					description = CASE WHEN $2::text IS NULL THEN description ELSE NULLIF($2, '') END,
+					public = COALESCE($3, public)
+				WHERE collection_id = $4`,
+				collectionReq.Name, collectionReq.Description, collectionReq.Public, collectionID)
+			if err != nil {
+				return fmt.Errorf("updating collection: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error updating collection:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, collection); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding updated collection", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to update collection")
+	}
+}
+
+// deleteCollectionHandler deletes a collection. Owners may delete their own
+// collections and admins any collection.
+func deleteCollectionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collectionID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			owner, err := lockCollection(r.Context(), tx, collectionID)
+			if err != nil {
+				return err
+			}
+			if owner != helpers2.GetUsernameFromContext(r.Context()) && helpers2.GetRoleFromContext(r.Context()) != "admin" {
+				return newStatusError(http.StatusForbidden, "Forbidden")
+			}
+			if _, err := tx.ExecContext(r.Context(), "DELETE FROM collection_entries WHERE collection_id=$1", collectionID); err != nil {
+				return fmt.Errorf("deleting collection entries: %w", err)
+			}
+			if _, err := tx.ExecContext(r.Context(), "DELETE FROM collections WHERE collection_id=$1", collectionID); err != nil {
+				return fmt.Errorf("deleting collection: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting collection:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete collection")
+	}
+}
+
+func addCollectionEntryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collectionID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var entryReq CollectionEntryRequest
+		if err := json.NewDecoder(r.Body).Decode(&entryReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding collection entry request", "error", err)
+			return
+		}
+		if entryReq.MovieID <= 0 || entryReq.Position < 0 || !validation.Description(entryReq.Note) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		collection, err := editCollection(r, db, collectionID, func(tx *sql.Tx) error {
+			err := ensureMovieExists(r.Context(), tx, entryReq.MovieID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return newStatusError(http.StatusUnprocessableEntity, "movie %d does not exist", entryReq.MovieID)
+			}
+			if err != nil {
+				return err
+			}
+			// Number the entries first so that the current position counts
+			// only the movies that are listed.
+			if err := renumberCollection(r.Context(), tx, collectionID); err != nil {
+				return err
+			}
+			var current sql.NullInt64
+			err = tx.QueryRowContext(r.Context(), `DELETE FROM collection_entries WHERE collection_id = $1 AND movie_id = $2
+				RETURNING position`, collectionID, entryReq.MovieID).Scan(&current)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("deleting collection entry: %w", err)
+			}
+			if err := renumberCollection(r.Context(), tx, collectionID); err != nil {
+				return err
+			}
+			var count int
+			err = tx.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM collection_entries ce
+				JOIN movies m ON m.movie_id = ce.movie_id AND m.deleted_at IS NULL
+				WHERE ce.collection_id = $1`, collectionID).
+				Scan(&count)
+			if err != nil {
+				return fmt.Errorf("counting collection entries: %w", err)
+			}
+			position := entryReq.Position
+			if position == 0 && current.Valid {
+				position = int(current.Int64)
+			}
+			if position == 0 || position > count+1 {
+				position = count + 1
+			}
+			_, err = tx.ExecContext(r.Context(), `UPDATE collection_entries SET position = position + 1
+				WHERE collection_id = $1 AND position >= $2`, collectionID, position)
+			if err != nil {
+				return fmt.Errorf("shifting collection entries: %w", err)
+			}
+			_, err = tx.ExecContext(r.Context(), `INSERT INTO collection_entries (collection_id, movie_id, position, note)
+				VALUES ($1, $2, $3, NULLIF($4, ''))`, collectionID, entryReq.MovieID, position, entryReq.Note)
+			if err != nil {
+				return fmt.Errorf("inserting collection entry: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error adding collection entry:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, collection); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding collection response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to add collection entry")
+	}
+}
+
+func removeCollectionEntryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collectionID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		movieID, err := idFromQuery(r, "movie_id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		collection, err := editCollection(r, db, collectionID, func(tx *sql.Tx) error {
+			result, err := tx.ExecContext(r.Context(), "DELETE FROM collection_entries WHERE collection_id=$1 AND movie_id=$2",
+				collectionID, movieID)
+			if err != nil {
+				return fmt.Errorf("deleting collection entry: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return newStatusError(http.StatusNotFound, "movie %d is not in the collection", movieID)
+			}
+			return renumberCollection(r.Context(), tx, collectionID)
+		})
+		if err != nil {
+			writeError(w, r, err, "Error removing collection entry:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, collection); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding collection response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to remove collection entry")
+	}
+}
+
+// reorderCollectionHandler sets the order of a collection's entries from a
+// permutation of its movie IDs. Trashed movies, which are not listed, are
+// neither expected nor accepted and keep their place after the others.
+func reorderCollectionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collectionID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var orderReq CollectionOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&orderReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding collection order request", "error", err)
+			return
+		}
+
+		collection, err := editCollection(r, db, collectionID, func(tx *sql.Tx) error {
+			var count int
+			err := tx.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM collection_entries ce
+				JOIN movies m ON m.movie_id = ce.movie_id AND m.deleted_at IS NULL
+				WHERE ce.collection_id = $1`, collectionID).
+				Scan(&count)
+			if err != nil {
+				return fmt.Errorf("counting collection entries: %w", err)
+			}
+			if len(orderReq.MovieIDs) != count {
+				return newStatusError(http.StatusUnprocessableEntity, "movie_ids must list all %d movies of the collection", count)
+			}
+			seen := make(map[int]bool, count)
+			for position, movieID := range orderReq.MovieIDs {
+				result, err := tx.ExecContext(r.Context(), `UPDATE collection_entries ce SET position = $1
+					FROM movies m
+					WHERE ce.collection_id = $2 AND ce.movie_id = $3 AND m.movie_id = ce.movie_id AND m.deleted_at IS NULL`,
+					position+1, collectionID, movieID)
+				if err != nil {
+					return fmt.Errorf("updating collection entry position: %w", err)
+				}
+				if affected, _ := result.RowsAffected(); affected == 0 || seen[movieID] {
+					return newStatusError(http.StatusUnprocessableEntity, "movie %d is not in the collection or is listed twice", movieID)
+				}
+				seen[movieID] = true
+			}
+			return renumberCollection(r.Context(), tx, collectionID)
+		})
+		if err != nil {
+			writeError(w, r, err, "Error reordering collection:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, collection); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding collection response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to reorder collection")
+	}
+}
+
+// getCollectionHandler returns a collection. Public collections can be read
+// by any user; private ones only by their owner and admins.
+func getCollectionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collectionID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		collection, err := fetchCollection(r.Context(), db, collectionID)
+		if err == nil && !collection.Public && collection.Username != helpers2.GetUsernameFromContext(r.Context()) &&
+			helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			writeError(w, r, err, "Error getting collection from database:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, collection); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding collection response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get collection")
+	}
+}
+
+// getCollectionsHandler browses public collections, most recently updated
+// first. With mine=true it lists the calling user's own collections instead,
+// private ones included.
+func getCollectionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, pageSize, err := pageFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query := r.URL.Query()
+		var filter sqlFilter
+		if mine, _ := strconv.ParseBool(query.Get("mine")); mine {
+			filter.where("c.username = " + filter.arg(helpers2.GetUsernameFromContext(r.Context())))
+		} else {
+			filter.where("c.public")
+			if username := query.Get("username"); username != "" {
+				filter.where("c.username = " + filter.arg(username))
+			}
+		}
+		if movie := query.Get("movie"); movie != "" {
+			movieID, err := strconv.Atoi(movie)
+			if err != nil {
+				http.Error(w, "invalid movie parameter", http.StatusBadRequest)
+				return
+			}
+			filter.where("EXISTS (SELECT 1 FROM collection_entries ce WHERE ce.collection_id = c.collection_id AND ce.movie_id = " +
+				filter.arg(movieID) + ")")
+		}
+
+		collectionPage := CollectionPageResponse{Collections: []CollectionResponse{}, Page: page, PageSize: pageSize}
+		err = db.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM collections c`+filter.clause(), filter.args...).
+			Scan(&collectionPage.Total)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error counting collections", "error", err)
+			return
+		}
+		limit, offset := filter.arg(pageSize), filter.arg((page-1)*pageSize)
+		rows, err := db.QueryContext(r.Context(), `SELECT `+collectionColumns+` FROM collections c`+filter.clause()+`
+			ORDER BY c.updated_at DESC, c.collection_id DESC
+			LIMIT `+limit+` OFFSET `+offset, filter.args...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting collections from database", "error", err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			collection, err := scanCollection(rows)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Error scanning collections", "error", err)
+				return
+			}
+			collectionPage.Collections = append(collectionPage.Collections, collection)
+		}
+
+		if err := writeJSONWithETag(w, r, collectionPage); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding collections response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get collections")
+	}
+}
+
+func validCollectionRequest(collectionReq CollectionRequest) bool {
+	return collectionReq.Description == nil || validation.Description(*collectionReq.Description)
+}
+
+// editCollection runs edit in a transaction after checking that the caller
+// owns the collection, then touches the collection and returns it.
+func editCollection(r *http.Request, db *sql.DB, collectionID int, edit func(tx *sql.Tx) error) (CollectionResponse, error) {
+	var collection CollectionResponse
+	err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+		owner, err := lockCollection(r.Context(), tx, collectionID)
+		if err != nil {
+			return err
+		}
+		if owner != helpers2.GetUsernameFromContext(r.Context()) {
+			return newStatusError(http.StatusForbidden, "Forbidden")
+		}
+		if err := edit(tx); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(r.Context(), "UPDATE collections SET updated_at=now() WHERE collection_id=$1", collectionID)
+		if err != nil {
+			return fmt.Errorf("updating collection: %w", err)
+		}
+		collection, err = fetchCollection(r.Context(), tx, collectionID)
+		return err
+	})
+	return collection, err
+}
+
+func lockCollection(ctx context.Context, tx *sql.Tx, collectionID int) (string, error) {
+	var owner string
+	err := tx.QueryRowContext(ctx, "SELECT username FROM collections WHERE collection_id = $1 FOR UPDATE", collectionID).Scan(&owner)
+	return owner, err
+}
+
+// renumberCollection closes gaps in the positions of a collection's entries,
+// numbering trashed movies last, after the ones that are listed.
+func renumberCollection(ctx context.Context, tx *sql.Tx, collectionID int) error {
+	_, err := tx.ExecContext(ctx, `UPDATE collection_entries ce SET position = ordered.position
+		FROM (
+			SELECT e.movie_id,
+				ROW_NUMBER() OVER (ORDER BY m.deleted_at IS NOT NULL, e.position, e.movie_id) AS position
+			FROM collection_entries e JOIN movies m ON m.movie_id = e.movie_id
+			WHERE e.collection_id = $1
+		) ordered
+		WHERE ce.collection_id = $1 AND ce.movie_id = ordered.movie_id
+			AND ce.position IS DISTINCT FROM ordered.position`, collectionID)
+	if err != nil {
+		return fmt.Errorf("renumbering collection entries: %w", err)
+	}
+	return nil
+}
+
+// collectionColumns is the select list, over collections aliased as c,
+// scanned by scanCollection.
+const collectionColumns = `c.collection_id, c.username, c.name, COALESCE(c.description, ''), c.public,
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'position', ce.position,
+			'movie_id', m.movie_id,
+			'name', m.name,
+			'release_date', COALESCE(to_char(m.release_date, 'YYYY-MM-DD'), ''),
+			'note', COALESCE(ce.note, '')
+		) ORDER BY ce.position)
+		FROM collection_entries ce
+		JOIN movies m ON m.movie_id = ce.movie_id AND m.deleted_at IS NULL
+		WHERE ce.collection_id = c.collection_id
+	), '[]'),
+	c.created_at, c.updated_at`
+
+func scanCollection(row rowScanner) (CollectionResponse, error) {
+	var collection CollectionResponse
+	var entriesJSON []byte
+	err := row.Scan(&collection.ID, &collection.Username, &collection.Name, &collection.Description, &collection.Public,
+		&entriesJSON, &collection.CreatedAt, &collection.UpdatedAt)
+	if err != nil {
+		return collection, err
+	}
+	if err := json.Unmarshal(entriesJSON, &collection.Entries); err != nil {
+		return collection, fmt.Errorf("unmarshalling collection entries JSON: %w", err)
+	}
+	collection.URL = "/collections/get?id=" + strconv.Itoa(collection.ID)
+	return collection, nil
+}
+
+func fetchCollection(ctx context.Context, q queryer, collectionID int) (CollectionResponse, error) {
+	return scanCollection(q.QueryRowContext(ctx, `SELECT `+collectionColumns+` FROM collections c WHERE c.collection_id = $1`,
+		collectionID))
+}
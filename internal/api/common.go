@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// queryer is implemented by both *sql.DB and *sql.Tx, so read helpers can be
+// shared between plain handlers and transactional ones.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// withTx runs fn inside a transaction, rolling back if fn fails and committing otherwise.
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// statusError carries the HTTP status a handler should respond with when it
+// is returned from inside a transaction. When details is set it is sent as
+// the JSON body instead of the plain message.
+type statusError struct {
+	status  int
+	message string
+	details interface{}
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+func newStatusError(status int, format string, args ...interface{}) error {
+	return &statusError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// writeError responds according to err: status errors keep their status,
+// missing rows become 404 and anything else is logged as an internal error.
+func writeError(w http.ResponseWriter, r *http.Request, err error, logMessage string) {
+	var statusErr *statusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.details != nil:
+		writeJSON(w, statusErr.status, statusErr.details)
+	case errors.As(err, &statusErr):
+		http.Error(w, statusErr.message, statusErr.status)
+	case errors.Is(err, sql.ErrNoRows):
+		http.NotFound(w, r)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), strings.TrimSuffix(logMessage, ":"), "error", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+func idFromQuery(r *http.Request, param string) (int, error) {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return 0, errors.New("missing " + param + " parameter")
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid " + param + " parameter")
+	}
+	return id, nil
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func intValue(value *int) int {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageFromQuery reads the 1-based page and page_size parameters, defaulting
+// to the first page of defaultPageSize items.
+func pageFromQuery(r *http.Request) (page, pageSize int, err error) {
+	page, pageSize = 1, defaultPageSize
+	if value := r.URL.Query().Get("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page <= 0 {
+			return 0, 0, errors.New("invalid page parameter")
+		}
+	}
+	if value := r.URL.Query().Get("page_size"); value != "" {
+		pageSize, err = strconv.Atoi(value)
+		if err != nil || pageSize <= 0 || pageSize > maxPageSize {
+			return 0, 0, fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+		}
+	}
+	return page, pageSize, nil
+}
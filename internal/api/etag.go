@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// versionETag is the strong ETag of a version of a movie or actor, sent by
+// the handlers that change them and checked against If-Match. Reads are
+// tagged from their body instead, as the same version can be rendered
+// differently, for instance in another language.
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// checkIfMatch validates the If-Match precondition against the current
+// version of a resource.
+func checkIfMatch(r *http.Request, requireIfMatch bool, version int) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if requireIfMatch {
+			return newStatusError(http.StatusPreconditionRequired, "If-Match header is required")
+		}
+		return nil
+	}
+	current := versionETag(version)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == current {
+			return nil
+		}
+	}
+	return newStatusError(http.StatusPreconditionFailed, "Resource has been modified")
+}
+
+// notModified sets the ETag header and reports whether the If-None-Match
+// precondition lets the handler answer with 304 Not Modified.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSONWithETag encodes a response, tagging it with a weak ETag derived
+// from the body so clients can revalidate with If-None-Match.
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+	if notModified(w, r, `W/"`+hex.EncodeToString(sum[:16])+`"`) {
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(append(body, '\n'))
+	return err
+}
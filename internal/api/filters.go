@@ -0,0 +1,168 @@
+package api
+
+import (
+	"github.com/lib/pq"
+	"movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/validation"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// sqlFilter collects WHERE conditions together with their positional arguments.
+type sqlFilter struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg registers a query argument and returns its placeholder.
+func (f *sqlFilter) arg(value interface{}) string {
+	f.args = append(f.args, value)
+	return "$" + strconv.Itoa(len(f.args))
+}
+
+func (f *sqlFilter) where(condition string) {
+	f.conditions = append(f.conditions, condition)
+}
+
+func (f *sqlFilter) clause() string {
+	if len(f.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conditions, " AND ")
+}
+
+// applyMovieFilters adds the filter query parameters shared by /movies and
+// /movies/search as conditions over movies aliased as m.
+func applyMovieFilters(r *http.Request, f *sqlFilter) error {
+	query := r.URL.Query()
+	f.where("m.deleted_at IS NULL")
+	if crew := query.Get("crew"); crew != "" {
+		personID, err := strconv.Atoi(crew)
+		if err != nil {
+			return newStatusError(http.StatusBadRequest, "invalid crew parameter")
+		}
+		condition := "EXISTS (SELECT 1 FROM movies_crew mc WHERE mc.movie_id = m.movie_id AND mc.person_id = " + f.arg(personID)
+		if role := query.Get("crew_role"); role != "" {
+			if !validation.CrewRole(role) {
+				return newStatusError(http.StatusBadRequest, "invalid crew_role parameter")
+			}
+			condition += " AND mc.role = " + f.arg(role)
+		}
+		f.where(condition + ")")
+	}
+
+	for param, operator := range map[string]string{"runtime_min": ">=", "runtime_max": "<="} {
+		if value := query.Get(param); value != "" {
+			minutes, err := strconv.Atoi(value)
+			if err != nil {
+				return newStatusError(http.StatusBadRequest, "invalid %s parameter", param)
+			}
+			f.where("m.runtime_minutes " + operator + " " + f.arg(minutes))
+		}
+	}
+	if language := query.Get("language"); language != "" {
+		if !validation.LanguageCode(language) {
+			return newStatusError(http.StatusBadRequest, "invalid language parameter")
+		}
+		f.where("m.original_language = " + f.arg(language))
+	}
+	if country := query.Get("country"); country != "" {
+		if !validation.CountryCode(country) {
+			return newStatusError(http.StatusBadRequest, "invalid country parameter")
+		}
+		f.where(f.arg(country) + " = ANY(m.countries)")
+	}
+
+	// in_watchlist and watched are relative to the calling user.
+	for param, table := range map[string]string{"in_watchlist": "watchlist", "watched": "watched"} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		include, err := strconv.ParseBool(value)
+		if err != nil {
+			return newStatusError(http.StatusBadRequest, "invalid %s parameter", param)
+		}
+		condition := "EXISTS (SELECT 1 FROM " + table + " ul WHERE ul.movie_id = m.movie_id AND ul.username = " +
+			f.arg(helpers.GetUsernameFromContext(r.Context())) + ")"
+		if !include {
+			condition = "NOT " + condition
+		}
+		f.where(condition)
+	}
+
+	genres := splitList(query.Get("genre"))
+	if len(genres) != 0 {
+		for i, genre := range genres {
+			genres[i] = strings.ToLower(genre)
+		}
+		genres = uniqueStrings(genres)
+		matchAll, err := matchAllParam(query.Get("genre_match"))
+		if err != nil {
+			return err
+		}
+		matched := `(SELECT COUNT(DISTINCT g.genre_id) FROM movies_genres mg JOIN genres g ON mg.genre_id = g.genre_id
+			WHERE mg.movie_id = m.movie_id AND lower(g.name) = ANY(` + f.arg(pq.Array(genres)) + `))`
+		f.where(matchCondition(matched, matchAll, len(genres)))
+	}
+
+	tags := splitList(query.Get("tag"))
+	if len(tags) != 0 {
+		for i, tag := range tags {
+			tags[i] = normalizeTag(tag)
+		}
+		tags = uniqueStrings(tags)
+		matchAll, err := matchAllParam(query.Get("tag_match"))
+		if err != nil {
+			return err
+		}
+		matched := `(SELECT COUNT(DISTINCT mt.tag) FROM movie_tags mt
+			WHERE mt.movie_id = m.movie_id AND mt.tag = ANY(` + f.arg(pq.Array(tags)) + `))`
+		f.where(matchCondition(matched, matchAll, len(tags)))
+	}
+	return nil
+}
+
+// splitList parses a comma-separated query parameter, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func uniqueStrings(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	unique := items[:0]
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
+
+func matchAllParam(value string) (bool, error) {
+	switch value {
+	case "", "any":
+		return false, nil
+	case "all":
+		return true, nil
+	default:
+		return false, newStatusError(http.StatusBadRequest, "match parameter must be any or all")
+	}
+}
+
+// matchCondition compares the number of matched values with the number
+// requested: any match needs at least one, all needs every distinct value.
+func matchCondition(matched string, matchAll bool, requested int) string {
+	if matchAll {
+		return matched + " = " + strconv.Itoa(requested)
+	}
+	return matched + " > 0"
+}
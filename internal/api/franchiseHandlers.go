@@ -0,0 +1,649 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log/slog"
+	"movieLibrary/internal/config"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/validation"
+	"net/http"
+	"strconv"
+)
+
+type FranchiseRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// FranchiseMovieRequest adds a movie to a franchise or moves it within the
+// franchise. Position is 1-based and defaults to the end for new members and
+// to the current position for existing ones.
+type FranchiseMovieRequest struct {
+	MovieID  int `json:"movie_id"`
+	Position int `json:"position,omitempty"`
+}
+
+type FranchiseOrderRequest struct {
+	MovieIDs []int `json:"movie_ids"`
+}
+
+// MovieRelationRequest relates another movie to the movie being edited:
+// "sequel" and "prequel" say what the related movie is to this one, and
+// "remake" that the related movie is a remake of this one.
+type MovieRelationRequest struct {
+	RelatedMovieID int    `json:"related_movie_id"`
+	Relation       string `json:"relation"`
+}
+
+func createFranchiseHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var franchiseReq FranchiseRequest
+		if err := json.NewDecoder(r.Body).Decode(&franchiseReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding franchise request on creating", "error", err)
+			return
+		}
+		if !validation.Name(franchiseReq.Name) || !validation.Description(franchiseReq.Description) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var franchise FranchiseResponse
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			var franchiseID int
+			err := tx.QueryRowContext(r.Context(), `INSERT INTO franchises (name, description) VALUES ($1, NULLIF($2, ''))
+				RETURNING franchise_id`, franchiseReq.Name, franchiseReq.Description).Scan(&franchiseID)
+			if err != nil {
+				return fmt.Errorf("inserting franchise: %w", err)
+			}
+			franchise, err = fetchFranchise(r.Context(), tx, franchiseID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error creating franchise:")
+			return
+		}
+
+		w.Header().Set("Location", "/franchises?id="+strconv.Itoa(franchise.ID))
+		if err := writeJSON(w, http.StatusCreated, franchise); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding created franchise", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to create franchise")
+	}
+}
+
+func updateFranchiseHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		franchiseID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var franchiseReq FranchiseRequest
+		if err := json.NewDecoder(r.Body).Decode(&franchiseReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding franchise request on updating", "error", err)
+			return
+		}
+		if !validation.Name(franchiseReq.Name) || !validation.Description(franchiseReq.Description) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		franchise, err := editFranchise(r, db, franchiseID, nil, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(r.Context(), "UPDATE franchises SET name=$1, description=NULLIF($2, '') WHERE franchise_id=$3",
+				franchiseReq.Name, franchiseReq.Description, franchiseID)
+			if err != nil {
+				return fmt.Errorf("updating franchise: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error updating franchise:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, franchise); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding updated franchise", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to update franchise")
+	}
+}
+
+func deleteFranchiseHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		franchiseID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			var movieIDs []int64
+			err := tx.QueryRowContext(r.Context(), `WITH deleted AS (
+					DELETE FROM franchise_movies WHERE franchise_id=$1 RETURNING movie_id
+				)
+				SELECT COALESCE(array_agg(movie_id), '{}') FROM deleted`, franchiseID).Scan(pq.Array(&movieIDs))
+			if err != nil {
+				return fmt.Errorf("deleting franchise movies: %w", err)
+			}
+			result, err := tx.ExecContext(r.Context(), "DELETE FROM franchises WHERE franchise_id=$1", franchiseID)
+			if err != nil {
+				return fmt.Errorf("deleting franchise: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return sql.ErrNoRows
+			}
+			// The movies of the franchise no longer show it.
+			return touchMovies(r.Context(), tx, movieIDs)
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting franchise:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete franchise")
+	}
+}
+
+// addFranchiseMovieHandler adds a movie to a franchise at a position. A
+// movie belongs to at most one franchise; adding it to another one moves it.
+func addFranchiseMovieHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		franchiseID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var memberReq FranchiseMovieRequest
+		if err := json.NewDecoder(r.Body).Decode(&memberReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding franchise movie request", "error", err)
+			return
+		}
+		if memberReq.MovieID <= 0 || memberReq.Position < 0 {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		franchise, err := editFranchise(r, db, franchiseID, []int{memberReq.MovieID}, func(tx *sql.Tx) error {
+			err := ensureMovieExists(r.Context(), tx, memberReq.MovieID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return newStatusError(http.StatusUnprocessableEntity, "movie %d does not exist", memberReq.MovieID)
+			}
+			if err != nil {
+				return err
+			}
+			// Number the movies first so that the current position counts
+			// only the movies that are listed.
+			if err := renumberFranchise(r.Context(), tx, franchiseID); err != nil {
+				return err
+			}
+			var previousFranchiseID, current int
+			err = tx.QueryRowContext(r.Context(), "DELETE FROM franchise_movies WHERE movie_id = $1 RETURNING franchise_id, position",
+				memberReq.MovieID).Scan(&previousFranchiseID, &current)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("deleting franchise movie: %w", err)
+			}
+			if previousFranchiseID != franchiseID {
+				current = 0
+				if previousFranchiseID != 0 {
+					if err := renumberFranchise(r.Context(), tx, previousFranchiseID); err != nil {
+						return err
+					}
+				}
+			}
+			if err := renumberFranchise(r.Context(), tx, franchiseID); err != nil {
+				return err
+			}
+			var count int
+			err = tx.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM franchise_movies fm
+				JOIN movies m ON m.movie_id = fm.movie_id AND m.deleted_at IS NULL
+				WHERE fm.franchise_id = $1`, franchiseID).
+				Scan(&count)
+			if err != nil {
+				return fmt.Errorf("counting franchise movies: %w", err)
+			}
+			position := memberReq.Position
+			if position == 0 {
+				position = current
+			}
+			if position == 0 || position > count+1 {
+				position = count + 1
+			}
+			_, err = tx.ExecContext(r.Context(), `UPDATE franchise_movies SET position = position + 1
+				WHERE franchise_id = $1 AND position >= $2`, franchiseID, position)
+			if err != nil {
+				return fmt.Errorf("shifting franchise movies: %w", err)
+			}
+			_, err = tx.ExecContext(r.Context(), "INSERT INTO franchise_movies (franchise_id, movie_id, position) VALUES ($1, $2, $3)",
+				franchiseID, memberReq.MovieID, position)
+			if err != nil {
+				return fmt.Errorf("inserting franchise movie: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error adding franchise movie:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, franchise); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding franchise response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to add franchise movie")
+	}
+}
+
+func removeFranchiseMovieHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		franchiseID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		movieID, err := idFromQuery(r, "movie_id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		franchise, err := editFranchise(r, db, franchiseID, nil, func(tx *sql.Tx) error {
+			result, err := tx.ExecContext(r.Context(), "DELETE FROM franchise_movies WHERE franchise_id=$1 AND movie_id=$2",
+				franchiseID, movieID)
+			if err != nil {
+				return fmt.Errorf("deleting franchise movie: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return newStatusError(http.StatusNotFound, "movie %d is not in the franchise", movieID)
+			}
+			return renumberFranchise(r.Context(), tx, franchiseID)
+		})
+		if err != nil {
+			writeError(w, r, err, "Error removing franchise movie:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, franchise); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding franchise response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to remove franchise movie")
+	}
+}
+
+// reorderFranchiseHandler sets the order of a franchise's movies from a
+// permutation of their IDs. Trashed movies, which are not listed, are neither
+// expected nor accepted and keep their place after the others.
+func reorderFranchiseHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		franchiseID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var orderReq FranchiseOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&orderReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding franchise order request", "error", err)
+			return
+		}
+
+		franchise, err := editFranchise(r, db, franchiseID, nil, func(tx *sql.Tx) error {
+			var count int
+			err := tx.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM franchise_movies fm
+				JOIN movies m ON m.movie_id = fm.movie_id AND m.deleted_at IS NULL
+				WHERE fm.franchise_id = $1`, franchiseID).
+				Scan(&count)
+			if err != nil {
+				return fmt.Errorf("counting franchise movies: %w", err)
+			}
+			if len(orderReq.MovieIDs) != count {
+				return newStatusError(http.StatusUnprocessableEntity, "movie_ids must list all %d movies of the franchise", count)
+			}
+			seen := make(map[int]bool, count)
+			for position, movieID := range orderReq.MovieIDs {
+				result, err := tx.ExecContext(r.Context(), `UPDATE franchise_movies fm SET position = $1
+					FROM movies m
+					WHERE fm.franchise_id = $2 AND fm.movie_id = $3 AND m.movie_id = fm.movie_id AND m.deleted_at IS NULL`,
+					position+1, franchiseID, movieID)
+				if err != nil {
+					return fmt.Errorf("updating franchise movie position: %w", err)
+				}
+				if affected, _ := result.RowsAffected(); affected == 0 || seen[movieID] {
+					return newStatusError(http.StatusUnprocessableEntity, "movie %d is not in the franchise or is listed twice", movieID)
+				}
+				seen[movieID] = true
+			}
+			return renumberFranchise(r.Context(), tx, franchiseID)
+		})
+		if err != nil {
+			writeError(w, r, err, "Error reordering franchise:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, franchise); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding franchise response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to reorder franchise")
+	}
+}
+
+// getFranchisesHandler lists franchises by name, or returns a single
+// franchise when an id is given.
+func getFranchisesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") != "" {
+			franchiseID, err := idFromQuery(r, "id")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			franchise, err := fetchFranchise(r.Context(), db, franchiseID)
+			if err != nil {
+				writeError(w, r, err, "Error getting franchise from database:")
+				return
+			}
+			if err := writeJSON(w, http.StatusOK, franchise); err != nil {
+				slog.ErrorContext(r.Context(), "Error encoding franchise response", "error", err)
+			}
+			return
+		}
+
+		rows, err := db.QueryContext(r.Context(), `SELECT `+franchiseColumns+` FROM franchises f ORDER BY f.name`)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting franchises from database", "error", err)
+			return
+		}
+		defer rows.Close()
+
+		franchises := []FranchiseResponse{}
+		for rows.Next() {
+			franchise, err := scanFranchise(rows)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Error scanning franchises", "error", err)
+				return
+			}
+			franchises = append(franchises, franchise)
+		}
+
+		if err := writeJSONWithETag(w, r, franchises); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding franchises response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get franchises")
+	}
+}
+
+func addMovieRelationHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var relationReq MovieRelationRequest
+		if err := json.NewDecoder(r.Body).Decode(&relationReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding movie relation request", "error", err)
+			return
+		}
+		if relationReq.RelatedMovieID <= 0 || relationReq.RelatedMovieID == movieID || !validation.MovieRelation(relationReq.Relation) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		movie, err := editMovie(r, db, cfg, movieID, func(tx *sql.Tx) error {
+			err := ensureMovieExists(r.Context(), tx, relationReq.RelatedMovieID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return newStatusError(http.StatusUnprocessableEntity, "movie %d does not exist", relationReq.RelatedMovieID)
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := deleteMovieRelation(r.Context(), tx, movieID, relationReq.RelatedMovieID); err != nil {
+				return err
+			}
+			// Relations are stored from the original's point of view, so a
+			// prequel is recorded as the current movie being its sequel.
+			from, to, relation := movieID, relationReq.RelatedMovieID, relationReq.Relation
+			if relation == "prequel" {
+				from, to, relation = to, from, "sequel"
+			}
+			_, err = tx.ExecContext(r.Context(), "INSERT INTO movie_relations (movie_id, related_movie_id, relation) VALUES ($1, $2, $3)",
+				from, to, relation)
+			if err != nil {
+				return fmt.Errorf("inserting movie relation: %w", err)
+			}
+			// The related movie lists the relation too.
+			return touchMovies(r.Context(), tx, []int64{int64(relationReq.RelatedMovieID)})
+		})
+		if err != nil {
+			writeError(w, r, err, "Error adding movie relation:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(movie.Version))
+		if err := writeJSON(w, http.StatusOK, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movie response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to add movie relation")
+	}
+}
+
+func removeMovieRelationHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		relatedMovieID, err := idFromQuery(r, "related_movie_id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		movie, err := editMovie(r, db, cfg, movieID, func(tx *sql.Tx) error {
+			deleted, err := deleteMovieRelation(r.Context(), tx, movieID, relatedMovieID)
+			if err != nil {
+				return err
+			}
+			if !deleted {
+				return errUnchanged
+			}
+			// The related movie lists the relation too.
+			return touchMovies(r.Context(), tx, []int64{int64(relatedMovieID)})
+		})
+		if err != nil {
+			writeError(w, r, err, "Error removing movie relation:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(movie.Version))
+		if err := writeJSON(w, http.StatusOK, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movie response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to remove movie relation")
+	}
+}
+
+// deleteMovieRelation removes the relation between two movies in either
+// direction and reports whether there was one.
+func deleteMovieRelation(ctx context.Context, tx *sql.Tx, movieID, relatedMovieID int) (bool, error) {
+	result, err := tx.ExecContext(ctx, `DELETE FROM movie_relations
+		WHERE (movie_id = $1 AND related_movie_id = $2) OR (movie_id = $2 AND related_movie_id = $1)`, movieID, relatedMovieID)
+	if err != nil {
+		return false, fmt.Errorf("deleting movie relation: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// editFranchise runs edit in a transaction with the franchise locked and
+// returns the updated franchise. The movies whose franchise the edit changes,
+// among the members of the franchise, movieIDs and the members of their
+// current franchises, get a new version and revision.
+func editFranchise(r *http.Request, db *sql.DB, franchiseID int, movieIDs []int, edit func(tx *sql.Tx) error) (FranchiseResponse, error) {
+	var franchise FranchiseResponse
+	err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+		var id int
+		err := tx.QueryRowContext(r.Context(), "SELECT franchise_id FROM franchises WHERE franchise_id = $1 FOR UPDATE", franchiseID).
+			Scan(&id)
+		if err != nil {
+			return err
+		}
+		var affected []int64
+		err = tx.QueryRowContext(r.Context(), `SELECT COALESCE(array_agg(DISTINCT movie_id), '{}') FROM (
+				SELECT movie_id FROM franchise_movies
+				WHERE franchise_id = $1 OR franchise_id IN (SELECT franchise_id FROM franchise_movies WHERE movie_id = ANY($2))
+				UNION ALL
+				SELECT unnest($2::int[])
+			) movies`, franchiseID, pq.Array(movieIDs)).Scan(pq.Array(&affected))
+		if err != nil {
+			return fmt.Errorf("reading franchise movies: %w", err)
+		}
+		before, err := movieFranchises(r.Context(), tx, affected)
+		if err != nil {
+			return err
+		}
+		if err := edit(tx); err != nil {
+			return err
+		}
+		after, err := movieFranchises(r.Context(), tx, affected)
+		if err != nil {
+			return err
+		}
+		var changed []int64
+		for _, movieID := range affected {
+			if before[movieID] != after[movieID] {
+				changed = append(changed, movieID)
+			}
+		}
+		if err := touchMovies(r.Context(), tx, changed); err != nil {
+			return err
+		}
+		franchise, err = fetchFranchise(r.Context(), tx, franchiseID)
+		return err
+	})
+	return franchise, err
+}
+
+// movieFranchises reads the franchise of each of the listed movies that is
+// not in the trash, as the JSON shown in the movie, keyed by movie ID.
+func movieFranchises(ctx context.Context, tx *sql.Tx, movieIDs []int64) (map[int64]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT m.movie_id, `+movieFranchiseSQL+`::text FROM movies m
+		WHERE m.movie_id = ANY($1) AND m.deleted_at IS NULL`, pq.Array(movieIDs))
+	if err != nil {
+		return nil, fmt.Errorf("reading movie franchises: %w", err)
+	}
+	defer rows.Close()
+
+	franchises := make(map[int64]string, len(movieIDs))
+	for rows.Next() {
+		var movieID int64
+		var franchise string
+		if err := rows.Scan(&movieID, &franchise); err != nil {
+			return nil, fmt.Errorf("scanning movie franchises: %w", err)
+		}
+		franchises[movieID] = franchise
+	}
+	return franchises, rows.Err()
+}
+
+// renumberFranchise closes gaps in the positions of a franchise's movies,
+// numbering trashed movies last, after the ones that are listed.
+func renumberFranchise(ctx context.Context, tx *sql.Tx, franchiseID int) error {
+	_, err := tx.ExecContext(ctx, `UPDATE franchise_movies fm SET position = ordered.position
+		FROM (
+			SELECT e.movie_id,
+				ROW_NUMBER() OVER (ORDER BY m.deleted_at IS NOT NULL, e.position, e.movie_id) AS position
+			FROM franchise_movies e JOIN movies m ON m.movie_id = e.movie_id
+			WHERE e.franchise_id = $1
+		) ordered
+		WHERE fm.franchise_id = $1 AND fm.movie_id = ordered.movie_id
+			AND fm.position IS DISTINCT FROM ordered.position`, franchiseID)
+	if err != nil {
+		return fmt.Errorf("renumbering franchise movies: %w", err)
+	}
+	return nil
+}
+
+// franchiseColumns is the select list, over franchises aliased as f,
+// scanned by scanFranchise.
+const franchiseColumns = `f.franchise_id, f.name, COALESCE(f.description, ''),
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'position', fm.position,
+			'movie_id', m.movie_id,
+			'name', m.name,
+			'release_date', COALESCE(to_char(m.release_date, 'YYYY-MM-DD'), '')
+		) ORDER BY fm.position)
+		FROM franchise_movies fm
+		JOIN movies m ON m.movie_id = fm.movie_id AND m.deleted_at IS NULL
+		WHERE fm.franchise_id = f.franchise_id
+	), '[]')`
+
+func scanFranchise(row rowScanner) (FranchiseResponse, error) {
+	var franchise FranchiseResponse
+	var moviesJSON []byte
+	if err := row.Scan(&franchise.ID, &franchise.Name, &franchise.Description, &moviesJSON); err != nil {
+		return franchise, err
+	}
+	if err := json.Unmarshal(moviesJSON, &franchise.Movies); err != nil {
+		return franchise, fmt.Errorf("unmarshalling franchise movies JSON: %w", err)
+	}
+	return franchise, nil
+}
+
+func fetchFranchise(ctx context.Context, q queryer, franchiseID int) (FranchiseResponse, error) {
+	return scanFranchise(q.QueryRowContext(ctx, `SELECT `+franchiseColumns+` FROM franchises f WHERE f.franchise_id = $1`,
+		franchiseID))
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"log/slog"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/validation"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type GenreRequest struct {
+	Name string `json:"name"`
+}
+
+func createGenreHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var genreReq GenreRequest
+		if err := json.NewDecoder(r.Body).Decode(&genreReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding genre request on creating", "error", err)
+			return
+		}
+		if !validation.Label(genreReq.Name) {
+			http.Error(w, "Invalid genre name", http.StatusBadRequest)
+			return
+		}
+
+		var genre GenreResponse
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			if err := ensureGenreNameFree(r.Context(), tx, genreReq.Name, 0); err != nil {
+				return err
+			}
+			var genreID int
+			err := tx.QueryRowContext(r.Context(), "INSERT INTO genres (name) VALUES ($1) RETURNING genre_id", genreReq.Name).
+				Scan(&genreID)
+			if err != nil {
+				return fmt.Errorf("inserting genre: %w", err)
+			}
+			genre, err = fetchGenre(r.Context(), tx, genreID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error creating genre:")
+			return
+		}
+
+		w.Header().Set("Location", "/genres?id="+strconv.Itoa(genre.ID))
+		if err := writeJSON(w, http.StatusCreated, genre); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding created genre", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to create genre")
+	}
+}
+
+func updateGenreHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		genreID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var genreReq GenreRequest
+		if err := json.NewDecoder(r.Body).Decode(&genreReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding genre request on updating", "error", err)
+			return
+		}
+		if !validation.Label(genreReq.Name) {
+			http.Error(w, "Invalid genre name", http.StatusBadRequest)
+			return
+		}
+
+		var genre GenreResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			if err := ensureGenreNameFree(r.Context(), tx, genreReq.Name, genreID); err != nil {
+				return err
+			}
+			result, err := tx.ExecContext(r.Context(), "UPDATE genres SET name=$1 WHERE genre_id=$2", genreReq.Name, genreID)
+			if err != nil {
+				return fmt.Errorf("updating genre: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return sql.ErrNoRows
+			}
+			genre, err = fetchGenre(r.Context(), tx, genreID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error updating genre:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, genre); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding updated genre", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to update genre")
+	}
+}
+
+func deleteGenreHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		genreID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(r.Context(), "DELETE FROM movies_genres WHERE genre_id=$1", genreID); err != nil {
+				return fmt.Errorf("deleting movie genres: %w", err)
+			}
+			result, err := tx.ExecContext(r.Context(), "DELETE FROM genres WHERE genre_id=$1", genreID)
+			if err != nil {
+				return fmt.Errorf("deleting genre: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting genre:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete genre")
+	}
+}
+
+// getGenresHandler lists the genre taxonomy with the number of movies in
+// each genre, or a single genre when an id is given.
+func getGenresHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") != "" {
+			genreID, err := idFromQuery(r, "id")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			genre, err := fetchGenre(r.Context(), db, genreID)
+			if err != nil {
+				writeError(w, r, err, "Error getting genre from database:")
+				return
+			}
+			if err := writeJSON(w, http.StatusOK, genre); err != nil {
+				slog.ErrorContext(r.Context(), "Error encoding genre response", "error", err)
+			}
+			return
+		}
+
+		rows, err := db.QueryContext(r.Context(), `SELECT `+genreColumns+` FROM genres g ORDER BY g.name`)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting genres from database", "error", err)
+			return
+		}
+		defer rows.Close()
+
+		genres := []GenreResponse{}
+		for rows.Next() {
+			var genre GenreResponse
+			if err := rows.Scan(&genre.ID, &genre.Name, &genre.MovieCount); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Error scanning genres", "error", err)
+				return
+			}
+			genres = append(genres, genre)
+		}
+
+		if err := writeJSONWithETag(w, r, genres); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding genres response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get genres")
+	}
+}
+
+// getTagsHandler lists the tags in use with the number of movies carrying each.
+func getTagsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := db.QueryContext(r.Context(), `SELECT tag, COUNT(*) FROM movie_tags
+			WHERE movie_id IN (SELECT movie_id FROM movies WHERE deleted_at IS NULL)
+			GROUP BY tag ORDER BY COUNT(*) DESC, tag`)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting tags from database", "error", err)
+			return
+		}
+		defer rows.Close()
+
+		tags := []TagResponse{}
+		for rows.Next() {
+			var tag TagResponse
+			if err := rows.Scan(&tag.Name, &tag.MovieCount); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Error scanning tags", "error", err)
+				return
+			}
+			tags = append(tags, tag)
+		}
+
+		if err := writeJSONWithETag(w, r, tags); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding tags response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get tags")
+	}
+}
+
+const genreColumns = `g.genre_id, g.name, (SELECT COUNT(*) FROM movies_genres mg
+	JOIN movies m ON m.movie_id = mg.movie_id AND m.deleted_at IS NULL
+	WHERE mg.genre_id = g.genre_id)`
+
+func fetchGenre(ctx context.Context, q queryer, genreID int) (GenreResponse, error) {
+	var genre GenreResponse
+	err := q.QueryRowContext(ctx, `SELECT `+genreColumns+` FROM genres g WHERE g.genre_id = $1`, genreID).
+		Scan(&genre.ID, &genre.Name, &genre.MovieCount)
+	return genre, err
+}
+
+func ensureGenreNameFree(ctx context.Context, tx *sql.Tx, name string, genreID int) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM genres WHERE lower(name) = lower($1) AND genre_id <> $2)",
+		name, genreID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("checking genre name: %w", err)
+	}
+	if exists {
+		return newStatusError(http.StatusConflict, "genre %q already exists", name)
+	}
+	return nil
+}
+
+// setMovieGenres replaces the genres of a movie. Genres are referenced by
+// name, case-insensitively, and must exist in the taxonomy.
+func setMovieGenres(ctx context.Context, tx *sql.Tx, movieID int, names []string) error {
+	lowered := make([]string, len(names))
+	for i, name := range names {
+		lowered[i] = strings.ToLower(name)
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT genre_id, lower(name) FROM genres WHERE lower(name) = ANY($1)", pq.Array(lowered))
+	if err != nil {
+		return fmt.Errorf("looking up genres: %w", err)
+	}
+	defer rows.Close()
+
+	genreIDs := make(map[string]int, len(names))
+	for rows.Next() {
+		var genreID int
+		var name string
+		if err := rows.Scan(&genreID, &name); err != nil {
+			return fmt.Errorf("scanning genres: %w", err)
+		}
+		genreIDs[name] = genreID
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var unknown []string
+	for i, name := range lowered {
+		if _, ok := genreIDs[name]; !ok {
+			unknown = append(unknown, names[i])
+		}
+	}
+	if len(unknown) != 0 {
+		return newStatusError(http.StatusUnprocessableEntity, "unknown genres: %s", strings.Join(unknown, ", "))
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM movies_genres WHERE movie_id = $1", movieID); err != nil {
+		return fmt.Errorf("deleting movie genres: %w", err)
+	}
+	for _, genreID := range genreIDs {
+		_, err := tx.ExecContext(ctx, "INSERT INTO movies_genres (movie_id, genre_id) VALUES ($1, $2)", movieID, genreID)
+		if err != nil {
+			return fmt.Errorf("inserting movie genre: %w", err)
+		}
+	}
+	return nil
+}
+
+// setMovieTags replaces the free-form tags of a movie. Tags are stored
+// trimmed and lower-cased.
+func setMovieTags(ctx context.Context, tx *sql.Tx, movieID int, tags []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM movie_tags WHERE movie_id = $1", movieID); err != nil {
+		return fmt.Errorf("deleting movie tags: %w", err)
+	}
+	for _, tag := range tags {
+		_, err := tx.ExecContext(ctx, "INSERT INTO movie_tags (movie_id, tag) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			movieID, normalizeTag(tag))
+		if err != nil {
+			return fmt.Errorf("inserting movie tag: %w", err)
+		}
+	}
+	return nil
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+func validLabels(labels []string) bool {
+	for _, label := range labels {
+		if !validation.Label(strings.TrimSpace(label)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,418 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"mime"
+	"movieLibrary/internal/config"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/imaging"
+	"movieLibrary/internal/pkg/storage"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// mediaPrefix is the path stored images are served under; image URLs are
+// this prefix followed by the storage key.
+const mediaPrefix = "/media/"
+
+// imageSizes are the widths thumbnails are generated at. Images narrower
+// than a size are stored at their own width rather than upscaled.
+var imageSizes = []struct {
+	name  string
+	width int
+}{
+	{"small", 185},
+	{"medium", 342},
+	{"large", 780},
+}
+
+// maxImagePixels bounds the width times height of uploaded images, which are
+// decoded in full; a small file can declare dimensions that would take
+// gigabytes to decode.
+const maxImagePixels = 40_000_000
+
+// imageExtensions maps the accepted sniffed content types to the extension
+// the original is stored with.
+var imageExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// storedImage is an uploaded image as recorded in the images table. Key is
+// the prefix its original and thumbnails are stored under.
+type storedImage struct {
+	Kind        string `json:"kind"`
+	Key         string `json:"key"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+// originalKey is the storage key of the uploaded file.
+func (img storedImage) originalKey() string {
+	return img.Key + "/original." + imageExtensions[img.ContentType]
+}
+
+// thumbnailKey is the storage key of the thumbnail of the named size.
+// Thumbnails of JPEGs are JPEGs; everything else is thumbnailed as PNG to
+// keep transparency.
+func (img storedImage) thumbnailKey(size string) string {
+	format := "png"
+	if img.ContentType == "image/jpeg" {
+		format = "jpg"
+	}
+	return img.Key + "/" + size + "." + format
+}
+
+func (img storedImage) objectKeys() []string {
+	keys := []string{img.originalKey()}
+	for _, size := range imageSizes {
+		keys = append(keys, img.thumbnailKey(size.name))
+	}
+	return keys
+}
+
+func (img storedImage) response() *ImageResponse {
+	response := &ImageResponse{
+		URL:         mediaPrefix + img.originalKey(),
+		ContentType: img.ContentType,
+		Width:       img.Width,
+		Height:      img.Height,
+		Thumbnails:  map[string]string{},
+	}
+	for _, size := range imageSizes {
+		response.Thumbnails[size.name] = mediaPrefix + img.thumbnailKey(size.name)
+	}
+	return response
+}
+
+// imagesByKind unmarshals the images JSON selected alongside a movie or actor.
+func imagesByKind(data []byte) (map[string]*ImageResponse, error) {
+	var images []storedImage
+	if err := json.Unmarshal(data, &images); err != nil {
+		return nil, fmt.Errorf("unmarshalling images JSON: %w", err)
+	}
+	byKind := make(map[string]*ImageResponse, len(images))
+	for _, img := range images {
+		byKind[img.Kind] = img.response()
+	}
+	return byKind, nil
+}
+
+// uploadMovieImageHandler stores the multipart "file" field as the movie's
+// poster or backdrop, replacing the previous one.
+func uploadMovieImageHandler(db *sql.DB, cfg config.Config, media storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		kind := r.URL.Query().Get("kind")
+		if kind != "poster" && kind != "backdrop" {
+			http.Error(w, "kind must be poster or backdrop", http.StatusBadRequest)
+			return
+		}
+
+		img, err := storeUploadedImage(w, r, cfg, media, "movies/"+strconv.Itoa(movieID), kind)
+		if err != nil {
+			writeError(w, r, err, "Error storing movie image:")
+			return
+		}
+		var replaced []storedImage
+		movie, err := editMovie(r, db, cfg, movieID, func(tx *sql.Tx) error {
+			var err error
+			replaced, err = deleteImages(r.Context(), tx, "movie_id = $1 AND kind = $2", movieID, kind)
+			if err != nil {
+				return err
+			}
+			return insertImage(r.Context(), tx, "movie_id", movieID, img)
+		})
+		if err != nil {
+			deleteImageObjects(r.Context(), media, []storedImage{img})
+			writeError(w, r, err, "Error saving movie image:")
+			return
+		}
+		deleteImageObjects(r.Context(), media, replaced)
+
+		w.Header().Set("ETag", versionETag(movie.Version))
+		if err := writeJSON(w, http.StatusOK, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movie response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to upload movie image")
+	}
+}
+
+func deleteMovieImageHandler(db *sql.DB, cfg config.Config, media storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		kind := r.URL.Query().Get("kind")
+
+		var deleted []storedImage
+		_, err = editMovie(r, db, cfg, movieID, func(tx *sql.Tx) error {
+			var err error
+			deleted, err = deleteImages(r.Context(), tx, "movie_id = $1 AND kind = $2", movieID, kind)
+			if err != nil {
+				return err
+			}
+			if len(deleted) == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting movie image:")
+			return
+		}
+		deleteImageObjects(r.Context(), media, deleted)
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete movie image")
+	}
+}
+
+// uploadActorImageHandler stores the multipart "file" field as the actor's
+// photo, replacing the previous one.
+func uploadActorImageHandler(db *sql.DB, cfg config.Config, media storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		actorID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		img, err := storeUploadedImage(w, r, cfg, media, "actors/"+strconv.Itoa(actorID), "photo")
+		if err != nil {
+			writeError(w, r, err, "Error storing actor image:")
+			return
+		}
+		var replaced []storedImage
+		actor, err := editActor(r, db, cfg, actorID, func(tx *sql.Tx) error {
+			var err error
+			replaced, err = deleteImages(r.Context(), tx, "actor_id = $1 AND kind = $2", actorID, "photo")
+			if err != nil {
+				return err
+			}
+			return insertImage(r.Context(), tx, "actor_id", actorID, img)
+		})
+		if err != nil {
+			deleteImageObjects(r.Context(), media, []storedImage{img})
+			writeError(w, r, err, "Error saving actor image:")
+			return
+		}
+		deleteImageObjects(r.Context(), media, replaced)
+
+		w.Header().Set("ETag", versionETag(actor.Version))
+		if err := writeJSON(w, http.StatusOK, actor); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding actor response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to upload actor image")
+	}
+}
+
+func deleteActorImageHandler(db *sql.DB, cfg config.Config, media storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		actorID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var deleted []storedImage
+		_, err = editActor(r, db, cfg, actorID, func(tx *sql.Tx) error {
+			var err error
+			deleted, err = deleteImages(r.Context(), tx, "actor_id = $1 AND kind = $2", actorID, "photo")
+			if err != nil {
+				return err
+			}
+			if len(deleted) == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting actor image:")
+			return
+		}
+		deleteImageObjects(r.Context(), media, deleted)
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete actor image")
+	}
+}
+
+// getMediaHandler serves stored images. Keys are unique per upload, so
+// responses can be cached indefinitely.
+func getMediaHandler(media storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		object, err := media.Get(r.Context(), key)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error reading media", "error", err)
+			return
+		}
+		defer object.Close()
+
+		w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		if _, err := io.Copy(w, object); err != nil {
+			slog.ErrorContext(r.Context(), "Error writing media", "error", err)
+		}
+	}
+}
+
+// storeUploadedImage reads the multipart "file" field, checks its sniffed
+// content type, size and dimensions, and stores the original with its thumbnails under
+// a new key below prefix.
+func storeUploadedImage(w http.ResponseWriter, r *http.Request, cfg config.Config, media storage.Store, prefix, kind string) (storedImage, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxUploadBytes)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return storedImage{}, uploadError(err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return storedImage{}, uploadError(err)
+	}
+
+	contentType := http.DetectContentType(data)
+	if _, ok := imageExtensions[contentType]; !ok {
+		return storedImage{}, newStatusError(http.StatusUnsupportedMediaType, "unsupported image type %s", contentType)
+	}
+	dimensions, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return storedImage{}, newStatusError(http.StatusBadRequest, "decoding image: %v", err)
+	}
+	if dimensions.Width*dimensions.Height > maxImagePixels {
+		return storedImage{}, newStatusError(http.StatusRequestEntityTooLarge, "image exceeds %d pixels", maxImagePixels)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return storedImage{}, newStatusError(http.StatusBadRequest, "decoding image: %v", err)
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return storedImage{}, fmt.Errorf("generating image key: %w", err)
+	}
+	img := storedImage{
+		Kind:        kind,
+		Key:         prefix + "/" + kind + "-" + hex.EncodeToString(suffix),
+		ContentType: contentType,
+		Width:       decoded.Bounds().Dx(),
+		Height:      decoded.Bounds().Dy(),
+	}
+
+	if err := media.Put(r.Context(), img.originalKey(), bytes.NewReader(data)); err != nil {
+		return storedImage{}, err
+	}
+	for _, size := range imageSizes {
+		var thumbnail bytes.Buffer
+		key := img.thumbnailKey(size.name)
+		if err := imaging.Encode(&thumbnail, imaging.Resize(decoded, size.width), path.Ext(key)[1:]); err != nil {
+			deleteImageObjects(r.Context(), media, []storedImage{img})
+			return storedImage{}, fmt.Errorf("encoding %s thumbnail: %w", size.name, err)
+		}
+		if err := media.Put(r.Context(), key, &thumbnail); err != nil {
+			deleteImageObjects(r.Context(), media, []storedImage{img})
+			return storedImage{}, err
+		}
+	}
+	return img, nil
+}
+
+// uploadError maps errors reading an upload to 413 when the size limit was
+// hit and 400 otherwise.
+func uploadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return newStatusError(http.StatusRequestEntityTooLarge, "image exceeds %d bytes", maxBytesErr.Limit)
+	}
+	return newStatusError(http.StatusBadRequest, "reading uploaded file: %v", err)
+}
+
+// insertImage records img as belonging to the movie or actor identified by
+// ownerColumn and ownerID.
+func insertImage(ctx context.Context, tx *sql.Tx, ownerColumn string, ownerID int, img storedImage) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO images (`+ownerColumn+`, kind, storage_key, content_type, width, height)
+		VALUES ($1, $2, $3, $4, $5, $6)`, ownerID, img.Kind, img.Key, img.ContentType, img.Width, img.Height)
+	if err != nil {
+		return fmt.Errorf("inserting image: %w", err)
+	}
+	return nil
+}
+
+// deleteImages deletes the image rows matching condition and returns them,
+// so their objects can be removed from storage once the transaction commits.
+func deleteImages(ctx context.Context, tx *sql.Tx, condition string, args ...interface{}) ([]storedImage, error) {
+	rows, err := tx.QueryContext(ctx, `DELETE FROM images WHERE `+condition+`
+		RETURNING kind, storage_key, content_type, width, height`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("deleting images: %w", err)
+	}
+	defer rows.Close()
+
+	var images []storedImage
+	for rows.Next() {
+		var img storedImage
+		if err := rows.Scan(&img.Kind, &img.Key, &img.ContentType, &img.Width, &img.Height); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// deleteImageObjects removes the stored files of images. Failures only leave
+// unreferenced files behind, so they are logged rather than returned.
+func deleteImageObjects(ctx context.Context, media storage.Store, images []storedImage) {
+	for _, img := range images {
+		for _, key := range img.objectKeys() {
+			if err := media.Delete(ctx, key); err != nil {
+				slog.ErrorContext(ctx, "Error deleting media object", "error", err)
+			}
+		}
+	}
+}
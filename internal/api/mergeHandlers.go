@@ -0,0 +1,384 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log/slog"
+	"movieLibrary/internal/config"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/storage"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// minNameSimilarity is the similarity, between 0 and 1, above which two
+// actors born on the same day are reported as likely duplicates.
+const minNameSimilarity = 0.8
+
+// MergeActorsRequest merges the duplicate SourceID into TargetID, which survives.
+type MergeActorsRequest struct {
+	SourceID int `json:"source_id"`
+	TargetID int `json:"target_id"`
+}
+
+// getDuplicateActorsHandler lists groups of actors that are likely the same
+// person: those whose names are equal once normalized, and those born on the
+// same day with similar names.
+func getDuplicateActorsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		rows, err := db.QueryContext(r.Context(), `SELECT actor_id, name, COALESCE(to_char(date_of_birth, 'YYYY-MM-DD'), '')
+			FROM actors WHERE deleted_at IS NULL ORDER BY actor_id`)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting actors from database", "error", err)
+			return
+		}
+		defer rows.Close()
+
+		var actors []ActorCandidate
+		for rows.Next() {
+			var actor ActorCandidate
+			if err := rows.Scan(&actor.ID, &actor.Name, &actor.DateOfBirth); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Error scanning actors", "error", err)
+				return
+			}
+			actors = append(actors, actor)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error reading actors", "error", err)
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, findDuplicateActors(actors)); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding duplicate actors", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get duplicate actors")
+	}
+}
+
+// mergeActorsHandler folds the source actor into the target in one
+// transaction: cast and guest links, aliases, translations and missing
+// details move to the target, the source's name becomes an alias, the
+// source is deleted and the merge is recorded in actor_merges. If-Match is
+// checked against the version of the target, which the merge rewrites.
+func mergeActorsHandler(db *sql.DB, cfg config.Config, media storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var mergeReq MergeActorsRequest
+		if err := json.NewDecoder(r.Body).Decode(&mergeReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding merge request", "error", err)
+			return
+		}
+		if mergeReq.SourceID <= 0 || mergeReq.TargetID <= 0 || mergeReq.SourceID == mergeReq.TargetID {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var actor ActorResponse
+		var images []storedImage
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			// Lock in ID order so concurrent merges of the same pair cannot deadlock.
+			versions := map[int]int{}
+			for _, actorID := range []int{min(mergeReq.SourceID, mergeReq.TargetID), max(mergeReq.SourceID, mergeReq.TargetID)} {
+				version, err := lockActor(r.Context(), tx, actorID)
+				if errors.Is(err, sql.ErrNoRows) {
+					return newStatusError(http.StatusNotFound, "actor %d does not exist", actorID)
+				}
+				if err != nil {
+					return err
+				}
+				versions[actorID] = version
+			}
+			if err := checkIfMatch(r, cfg.RequireIfMatch, versions[mergeReq.TargetID]); err != nil {
+				return err
+			}
+			var err error
+			images, err = mergeActors(r.Context(), tx, mergeReq.SourceID, mergeReq.TargetID,
+				helpers2.GetUsernameFromContext(r.Context()))
+			if err != nil {
+				return err
+			}
+			actor, err = fetchActor(r.Context(), tx, mergeReq.TargetID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error merging actors:")
+			return
+		}
+		deleteImageObjects(r.Context(), media, images)
+
+		w.Header().Set("ETag", versionETag(actor.Version))
+		if err := writeJSON(w, http.StatusOK, actor); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding merged actor", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to merge actors")
+	}
+}
+
+func getActorMergesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		rows, err := db.QueryContext(r.Context(), `SELECT merge_id, source_actor_id, source_name,
+				COALESCE(to_char(source_date_of_birth, 'YYYY-MM-DD'), ''), target_actor_id, array_to_json(movie_ids),
+				merged_by, merged_at
+			FROM actor_merges ORDER BY merged_at DESC, merge_id DESC`)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting actor merges from database", "error", err)
+			return
+		}
+		defer rows.Close()
+
+		merges := []ActorMergeResponse{}
+		for rows.Next() {
+			var merge ActorMergeResponse
+			var movieIDsJSON []byte
+			err := rows.Scan(&merge.ID, &merge.SourceID, &merge.SourceName, &merge.SourceDateOfBirth, &merge.TargetID,
+				&movieIDsJSON, &merge.MergedBy, &merge.MergedAt)
+			if err == nil {
+				err = json.Unmarshal(movieIDsJSON, &merge.MovieIDs)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Error scanning actor merges", "error", err)
+				return
+			}
+			merges = append(merges, merge)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error reading actor merges", "error", err)
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, merges); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding actor merges", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get actor merges")
+	}
+}
+
+// mergeActors moves everything attached to sourceID over to targetID and
+// deletes sourceID. It returns the source images that were not kept, whose
+// objects should be removed once the transaction commits. Both actors must
+// already be locked by tx.
+func mergeActors(ctx context.Context, tx *sql.Tx, sourceID, targetID int, mergedBy string) ([]storedImage, error) {
+	var movieIDs []int64
+	err := tx.QueryRowContext(ctx, "SELECT COALESCE(array_agg(movie_id ORDER BY movie_id), '{}') FROM movies_actors WHERE actor_id = $1",
+		sourceID).Scan(pq.Array(&movieIDs))
+	if err != nil {
+		return nil, fmt.Errorf("reading merged movies: %w", err)
+	}
+
+	statements := []struct {
+		query string
+		what  string
+	}{
+		// Movies both actors appear in keep one credit with the union of the characters.
+		{`UPDATE movies_actors t SET
+				characters = ARRAY(SELECT DISTINCT unnest(t.characters || s.characters)),
+				billing_order = LEAST(t.billing_order, s.billing_order),
+				credit_type = COALESCE(t.credit_type, s.credit_type)
+			FROM movies_actors s
+			WHERE s.actor_id = $1 AND t.actor_id = $2 AND t.movie_id = s.movie_id`, "merging shared credits"},
+		{`DELETE FROM movies_actors s USING movies_actors t
+			WHERE s.actor_id = $1 AND t.actor_id = $2 AND t.movie_id = s.movie_id`, "deleting shared credits"},
+		{`UPDATE movies_actors SET actor_id = $2 WHERE actor_id = $1`, "moving credits"},
+		{`UPDATE episodes_actors t SET characters = ARRAY(SELECT DISTINCT unnest(t.characters || s.characters))
+			FROM episodes_actors s
+			WHERE s.actor_id = $1 AND t.actor_id = $2 AND t.episode_id = s.episode_id`, "merging shared guest credits"},
+		{`DELETE FROM episodes_actors s USING episodes_actors t
+			WHERE s.actor_id = $1 AND t.actor_id = $2 AND t.episode_id = s.episode_id`, "deleting shared guest credits"},
+		{`UPDATE episodes_actors SET actor_id = $2 WHERE actor_id = $1`, "moving guest credits"},
+		// The source's own name and aliases become aliases of the target,
+		// unless the target is already known by them.
+		{`INSERT INTO actor_aliases (actor_id, name, kind)
+			SELECT $2::int, name, 'other' FROM actors WHERE actor_id = $1
+			UNION ALL
+			SELECT $2::int, name, kind FROM actor_aliases WHERE actor_id = $1
+			ON CONFLICT (actor_id, name) DO NOTHING`, "moving aliases"},
+		{`DELETE FROM actor_aliases WHERE actor_id = $2 AND name = (SELECT name FROM actors WHERE actor_id = $2)`,
+			"deleting aliases equal to the surviving name"},
+		{`DELETE FROM actor_aliases WHERE actor_id = $1`, "deleting merged aliases"},
+		{`INSERT INTO actor_translations (actor_id, language, name)
+			SELECT $2::int, language, name FROM actor_translations WHERE actor_id = $1
+			ON CONFLICT (actor_id, language) DO NOTHING`, "moving translations"},
+		{`DELETE FROM actor_translations WHERE actor_id = $1`, "deleting merged translations"},
+		{`UPDATE images SET actor_id = $2
+			WHERE actor_id = $1 AND NOT EXISTS(SELECT 1 FROM images WHERE actor_id = $2 AND kind = 'photo')`, "moving photo"},
+		{`UPDATE actors t SET
+				sex = COALESCE(t.sex, s.sex),
+				date_of_birth = COALESCE(t.date_of_birth, s.date_of_birth),
+				version = t.version + 1,
+				updated_at = now()
+			FROM actors s
+			WHERE s.actor_id = $1 AND t.actor_id = $2`, "filling in missing details"},
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement.query, sourceID, targetID); err != nil {
+			return nil, fmt.Errorf("%s: %w", statement.what, err)
+		}
+	}
+	if err := recordRevision(ctx, tx, actorEntity, sourceID, "merge"); err != nil {
+		return nil, err
+	}
+	if err := recordRevision(ctx, tx, actorEntity, targetID, "update"); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO actor_merges (source_actor_id, source_name, source_date_of_birth, target_actor_id, movie_ids, merged_by)
+		SELECT actor_id, name, date_of_birth, $2::int, $3::int[], $4::varchar FROM actors WHERE actor_id = $1`,
+		sourceID, targetID, pq.Array(movieIDs), mergedBy)
+	if err != nil {
+		return nil, fmt.Errorf("recording merge: %w", err)
+	}
+
+	images, err := deleteImages(ctx, tx, "actor_id = $1", sourceID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM actors WHERE actor_id = $1", sourceID); err != nil {
+		return nil, fmt.Errorf("deleting merged actor: %w", err)
+	}
+	// The cast of every affected movie changed.
+	_, err = tx.ExecContext(ctx, "UPDATE movies SET version = version + 1, updated_at = now() WHERE movie_id = ANY($1)",
+		pq.Array(movieIDs))
+	if err != nil {
+		return nil, fmt.Errorf("updating merged movie versions: %w", err)
+	}
+	if err := recordMovieRevisions(ctx, tx, movieIDs); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// mergedActorSurvivor follows the merges of actorID, whose target may itself
+// have been merged into another actor later, to the actor that absorbed it
+// last. ok is false when actorID was never merged.
+func mergedActorSurvivor(ctx context.Context, q queryer, actorID int) (survivorID int, ok bool, err error) {
+	err = q.QueryRowContext(ctx, `WITH RECURSIVE chain (actor_id, depth) AS (
+			SELECT target_actor_id, 1 FROM actor_merges WHERE source_actor_id = $1
+			UNION ALL
+			SELECT m.target_actor_id, c.depth + 1 FROM actor_merges m JOIN chain c ON m.source_actor_id = c.actor_id
+		)
+		SELECT actor_id FROM chain ORDER BY depth DESC LIMIT 1`, actorID).Scan(&survivorID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return survivorID, true, nil
+}
+
+// findDuplicateActors groups actors with equal normalized names, then pairs
+// up the remaining actors born on the same day whose names are similar.
+func findDuplicateActors(actors []ActorCandidate) []DuplicateActorsResponse {
+	duplicates := []DuplicateActorsResponse{}
+
+	byName := map[string][]ActorCandidate{}
+	var names []string
+	for _, actor := range actors {
+		name := normalizeActorName(actor.Name)
+		if _, ok := byName[name]; !ok {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], actor)
+	}
+	for _, name := range names {
+		if group := byName[name]; len(group) > 1 {
+			duplicates = append(duplicates, DuplicateActorsResponse{Reason: "same_name", Actors: group})
+		}
+	}
+
+	byBirthDate := map[string][]ActorCandidate{}
+	var birthDates []string
+	for _, actor := range actors {
+		if actor.DateOfBirth == "" {
+			continue
+		}
+		if _, ok := byBirthDate[actor.DateOfBirth]; !ok {
+			birthDates = append(birthDates, actor.DateOfBirth)
+		}
+		byBirthDate[actor.DateOfBirth] = append(byBirthDate[actor.DateOfBirth], actor)
+	}
+	for _, birthDate := range birthDates {
+		group := byBirthDate[birthDate]
+		for i := range group {
+			for j := i + 1; j < len(group); j++ {
+				a, b := group[i], group[j]
+				nameA, nameB := normalizeActorName(a.Name), normalizeActorName(b.Name)
+				if nameA == nameB {
+					continue // already reported as same_name
+				}
+				if nameSimilarity(nameA, nameB) >= minNameSimilarity {
+					duplicates = append(duplicates, DuplicateActorsResponse{
+						Reason: "similar_name_same_birth_date",
+						Actors: []ActorCandidate{a, b},
+					})
+				}
+			}
+		}
+	}
+	return duplicates
+}
+
+// normalizeActorName lowercases name and reduces punctuation and runs of
+// whitespace to single spaces, so "Samuel L. Jackson" and "samuel l jackson"
+// compare equal.
+func normalizeActorName(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// nameSimilarity is 1 minus the edit distance between a and b relative to
+// the longer of the two.
+func nameSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return 1 - float64(previous[len(rb)])/float64(longest)
+}
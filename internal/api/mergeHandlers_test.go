@@ -0,0 +1,146 @@
+package api
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeActorName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Samuel L. Jackson", "samuel l jackson"},
+		{"samuel l jackson", "samuel l jackson"},
+		{"  Tom   Hanks ", "tom hanks"},
+		{"Jean-Luc Godard", "jean luc godard"},
+		{"Sinéad O'Connor", "sinéad o connor"},
+		{"50 Cent", "50 cent"},
+		{"...", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeActorName(tt.name); got != tt.want {
+				t.Errorf("normalizeActorName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"tom hanks", "tom hanks", 1},
+		{"tom hanks", "", 0},
+		{"tom hanks", "tom hank", 1 - 1.0/9},
+		{"kitten", "sitting", 1 - 3.0/7},
+		{"abc", "xyz", 0},
+		// Distances count runes, not bytes.
+		{"zoë", "zoe", 1 - 1.0/3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			for _, args := range [][2]string{{tt.a, tt.b}, {tt.b, tt.a}} {
+				if got := nameSimilarity(args[0], args[1]); math.Abs(got-tt.want) > 1e-9 {
+					t.Errorf("nameSimilarity(%q, %q) = %v, want %v", args[0], args[1], got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFindDuplicateActors(t *testing.T) {
+	tests := []struct {
+		name   string
+		actors []ActorCandidate
+		want   []DuplicateActorsResponse
+	}{
+		{
+			name: "no actors",
+			want: []DuplicateActorsResponse{},
+		},
+		{
+			name: "distinct actors",
+			actors: []ActorCandidate{
+				{ID: 1, Name: "Tom Hanks", DateOfBirth: "1956-07-09"},
+				{ID: 2, Name: "Meg Ryan", DateOfBirth: "1961-11-19"},
+			},
+			want: []DuplicateActorsResponse{},
+		},
+		{
+			name: "same normalized name",
+			actors: []ActorCandidate{
+				{ID: 1, Name: "Samuel L. Jackson"},
+				{ID: 2, Name: "Meg Ryan"},
+				{ID: 3, Name: "samuel l jackson", DateOfBirth: "1948-12-21"},
+			},
+			want: []DuplicateActorsResponse{
+				{Reason: "same_name", Actors: []ActorCandidate{
+					{ID: 1, Name: "Samuel L. Jackson"},
+					{ID: 3, Name: "samuel l jackson", DateOfBirth: "1948-12-21"},
+				}},
+			},
+		},
+		{
+			name: "similar name on the same birth date",
+			actors: []ActorCandidate{
+				{ID: 1, Name: "Tom Hanks", DateOfBirth: "1956-07-09"},
+				{ID: 2, Name: "Tom Hank", DateOfBirth: "1956-07-09"},
+			},
+			want: []DuplicateActorsResponse{
+				{Reason: "similar_name_same_birth_date", Actors: []ActorCandidate{
+					{ID: 1, Name: "Tom Hanks", DateOfBirth: "1956-07-09"},
+					{ID: 2, Name: "Tom Hank", DateOfBirth: "1956-07-09"},
+				}},
+			},
+		},
+		{
+			name: "similar name on different birth dates",
+			actors: []ActorCandidate{
+				{ID: 1, Name: "Tom Hanks", DateOfBirth: "1956-07-09"},
+				{ID: 2, Name: "Tom Hank", DateOfBirth: "1956-07-10"},
+			},
+			want: []DuplicateActorsResponse{},
+		},
+		{
+			name: "similar name without birth dates",
+			actors: []ActorCandidate{
+				{ID: 1, Name: "Tom Hanks"},
+				{ID: 2, Name: "Tom Hank"},
+			},
+			want: []DuplicateActorsResponse{},
+		},
+		{
+			name: "dissimilar names on the same birth date",
+			actors: []ActorCandidate{
+				{ID: 1, Name: "Tom Hanks", DateOfBirth: "1956-07-09"},
+				{ID: 2, Name: "Meg Ryan", DateOfBirth: "1956-07-09"},
+			},
+			want: []DuplicateActorsResponse{},
+		},
+		{
+			name: "same name is not reported again as similar",
+			actors: []ActorCandidate{
+				{ID: 1, Name: "Tom Hanks", DateOfBirth: "1956-07-09"},
+				{ID: 2, Name: "tom hanks", DateOfBirth: "1956-07-09"},
+			},
+			want: []DuplicateActorsResponse{
+				{Reason: "same_name", Actors: []ActorCandidate{
+					{ID: 1, Name: "Tom Hanks", DateOfBirth: "1956-07-09"},
+					{ID: 2, Name: "tom hanks", DateOfBirth: "1956-07-09"},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findDuplicateActors(tt.actors); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findDuplicateActors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log/slog"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_failures_total",
+		Help: "Requests rejected for missing, malformed or invalid credentials.",
+	}, []string{"reason"})
+	auditWriteFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "audit_write_failures_total",
+		Help: "Audit log entries that could not be written.",
+	})
+	auditSuppressed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "audit_suppressed_total",
+		Help: "Failed authentications not written to the audit log because their source address exceeded the rate limit.",
+	})
+	trashPurgeFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "trash_purge_failures_total",
+		Help: "Movies and actors the purge job failed to remove from the trash, by type.",
+	}, []string{"type"})
+	catalogMovies = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "catalog_movies",
+		Help: "Movies in the catalog, excluding the trash.",
+	})
+	catalogActors = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "catalog_actors",
+		Help: "Actors in the catalog, excluding the trash.",
+	})
+)
+
+// metricMethods are the request methods that get their own series; any other
+// method is counted as "other", so clients cannot create series at will.
+var metricMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// metricsMiddleware counts and times every request by the router pattern it
+// matched, so that paths with different IDs share a series.
+func metricsMiddleware(router *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		method := r.Method
+		if !metricMethods[method] {
+			method = "other"
+		}
+		route := routePattern(router, r)
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(rec.status)
+		httpRequests.WithLabelValues(method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// getMetricsHandler exposes the collected metrics, including the database
+// connection pool statistics and the catalog size, in the Prometheus text
+// format. Only admins may read them.
+func getMetricsHandler(db *sql.DB) http.HandlerFunc {
+	exposition := promhttp.Handler()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var movies, actors int
+		err := db.QueryRowContext(r.Context(), `SELECT
+				(SELECT COUNT(*) FROM movies WHERE deleted_at IS NULL),
+				(SELECT COUNT(*) FROM actors WHERE deleted_at IS NULL)`).Scan(&movies, &actors)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error counting catalog for metrics", "error", err)
+			return
+		}
+		catalogMovies.Set(float64(movies))
+		catalogActors.Set(float64(actors))
+
+		exposition.ServeHTTP(w, r)
+
+		slog.DebugContext(r.Context(), "Received request to get metrics")
+	}
+}
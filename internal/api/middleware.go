@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxRequestIDLength bounds the client supplied request IDs that are reused.
+const maxRequestIDLength = 100
+
+// requestIDMiddleware gives every request an ID, reusing the X-Request-ID
+// header when the client sent a usable one, stores it in the request context
+// and echoes it in the response.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "request_id", requestID)))
+	})
+}
+
+// accessLogMiddleware logs every request once it has been answered, with its
+// status, response size, latency and the authenticated principal.
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		slog.LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.bytes),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("principal", rec.principal),
+		)
+	})
+}
+
+// statusRecorder remembers the status code a handler responded with, the
+// number of body bytes it wrote and who it was authenticated as.
+type statusRecorder struct {
+	http.ResponseWriter
+	status    int
+	bytes     int
+	principal string
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// setPrincipal tells the access log who the request was authenticated as. The
+// username in the request context is not visible to it, as that context is
+// derived from the one it logs with.
+func setPrincipal(w http.ResponseWriter, username string) {
+	if rec, ok := w.(*statusRecorder); ok {
+		rec.principal = username
+	}
+}
+
+// tracingMiddleware runs every request in a server span, continuing the trace
+// of the W3C traceparent header when the client sent one.
+func tracingMiddleware(router *http.ServeMux, next http.Handler) http.Handler {
+	tracer := otel.Tracer("movieLibrary/internal/api")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := routePattern(router, r)
+		name := r.Method
+		if route != "" {
+			name += " " + route
+		}
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path),
+			semconv.HTTPRoute(route),
+		))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// routePattern returns the path of the router pattern r matches, such as
+// "/movies/rating", or "" if it matches none.
+func routePattern(router *http.ServeMux, r *http.Request) string {
+	_, pattern := router.Handler(r)
+	// Patterns such as "GET /movies/rating" name the method too.
+	return pattern[strings.IndexByte(pattern, ' ')+1:]
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id[:])
+}
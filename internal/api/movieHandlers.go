@@ -1,9 +1,14 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log/slog"
+	"movieLibrary/internal/config"
 	helpers2 "movieLibrary/internal/pkg/helpers"
 	"movieLibrary/internal/pkg/validation"
 	"net/http"
@@ -12,11 +17,45 @@ import (
 )
 
 type MovieRequest struct {
-	Name        string   `json:"name,omitempty"`
-	Description string   `json:"description,omitempty"`
-	ReleaseDate string   `json:"release_date,omitempty"`
-	Rating      string   `json:"rating,omitempty"`
-	Actors      []string `json:"actors,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	ReleaseDate string `json:"release_date,omitempty"`
+	// EditorialRating is the admin-entered rating. Rating is accepted as its
+	// former name.
+	EditorialRating string              `json:"editorial_rating,omitempty"`
+	Rating          string              `json:"rating,omitempty"`
+	Actors          []ActorRef          `json:"actors,omitempty"`
+	Cast            []CastMemberRequest `json:"cast,omitempty"`
+	// Genres and Tags replace the current ones when present; an empty list clears them.
+	Genres []string `json:"genres,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+
+	RuntimeMinutes   int    `json:"runtime_minutes,omitempty"`
+	OriginalTitle    string `json:"original_title,omitempty"`
+	OriginalLanguage string `json:"original_language,omitempty"`
+	// Countries and Certifications replace the current values when present.
+	Countries []string `json:"countries,omitempty"`
+	// Certifications maps a country code to the age certification there, e.g. "US": "R".
+	Certifications map[string]string `json:"certifications,omitempty"`
+	Budget         int64             `json:"budget,omitempty"`
+	BoxOffice      int64             `json:"box_office,omitempty"`
+	ImdbID         string            `json:"imdb_id,omitempty"`
+	TmdbID         int               `json:"tmdb_id,omitempty"`
+
+	// CreateMissingActors creates actors referenced by a name that matches
+	// no existing actor instead of rejecting the request.
+	CreateMissingActors bool `json:"create_missing_actors,omitempty"`
+}
+
+// CastMemberRequest describes an actor's credit on a movie. The actor is
+// referenced by actor_id or, failing that, by name. BillingOrder defaults to
+// the member's position in the cast list.
+type CastMemberRequest struct {
+	ActorID      int      `json:"actor_id,omitempty"`
+	Name         string   `json:"name,omitempty"`
+	Characters   []string `json:"characters,omitempty"`
+	BillingOrder int      `json:"billing_order,omitempty"`
+	CreditType   string   `json:"credit_type,omitempty"`
 }
 
 func createMovieHandler(db *sql.DB) http.HandlerFunc {
@@ -28,102 +67,111 @@ func createMovieHandler(db *sql.DB) http.HandlerFunc {
 		var movieReq MovieRequest
 		if err := json.NewDecoder(r.Body).Decode(&movieReq); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
-			helpers2.ErrorLogger.Println("Error decoding request body on creating movie:", err)
+			slog.ErrorContext(r.Context(), "Error decoding request body on creating movie", "error", err)
 			return
 		}
-		if !validation.Name(movieReq.Name) || !validation.Description(movieReq.Description) || !validation.Rating(movieReq.Rating) {
+		if !validMovieRequest(movieReq) {
 			http.Error(w, "Bad request body", http.StatusBadRequest)
 			return
 		}
 
-		tx, err := db.Begin()
+		var movie MovieResponse
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			movieID, err := insertMovie(r.Context(), tx, movieReq)
+			if err != nil {
+				return err
+			}
+			movie, err = fetchMovie(r.Context(), tx, movieID)
+			return err
+		})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error starting transaction:", err)
+			slog.ErrorContext(r.Context(), "Error creating movie", "error", err)
 			return
 		}
-		defer func() {
-			if err != nil {
-				tx.Rollback()
-				helpers2.ErrorLogger.Println("Transaction rolled back:", err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			err = tx.Commit()
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				helpers2.ErrorLogger.Println("Error committing transaction:", err)
+
+		w.Header().Set("Location", movieLocation(movie.ID))
+		w.Header().Set("ETag", versionETag(movie.Version))
+		if err := writeJSON(w, http.StatusCreated, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding created movie", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to create movie")
+	}
+}
+
+func bulkCreateMoviesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var movieReqs []MovieRequest
+		if err := json.NewDecoder(r.Body).Decode(&movieReqs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding request body on bulk creating movies", "error", err)
+			return
+		}
+		if len(movieReqs) == 0 {
+			http.Error(w, "Empty request body", http.StatusBadRequest)
+			return
+		}
+		for i, movieReq := range movieReqs {
+			if !validMovieRequest(movieReq) {
+				http.Error(w, fmt.Sprintf("Bad request body at index %d", i), http.StatusBadRequest)
 				return
 			}
-		}()
+		}
 
-		var movieID int
-		insertQuery := "INSERT INTO movies (name, description, release_date, rating) VALUES ($1,$2, $3, $4) RETURNING movie_id"
-		err = tx.QueryRow(insertQuery, movieReq.Name, movieReq.Description, movieReq.ReleaseDate, movieReq.Rating).Scan(&movieID)
+		movies := make([]MovieResponse, 0, len(movieReqs))
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			for _, movieReq := range movieReqs {
+				movieID, err := insertMovie(r.Context(), tx, movieReq)
+				if err != nil {
+					return err
+				}
+				movie, err := fetchMovie(r.Context(), tx, movieID)
+				if err != nil {
+					return err
+				}
+				movies = append(movies, movie)
+			}
+			return nil
+		})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error inserting movie into database:", err)
+			slog.ErrorContext(r.Context(), "Error bulk creating movies", "error", err)
 			return
 		}
 
-		for _, actorName := range movieReq.Actors {
-			var actorID int
-			err := db.QueryRow("SELECT actor_id FROM actors WHERE name = $1", actorName).Scan(&actorID)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				helpers2.ErrorLogger.Println("Error getting actor ID from database:", err)
-				return
-			}
-
-			_, err = tx.Exec("INSERT INTO movies_actors (movie_id, actor_id) VALUES ($1,$2)", movieID, actorID)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				helpers2.ErrorLogger.Println("Error inserting movie actor into database:", err)
-				return
-			}
+		if err := writeJSON(w, http.StatusCreated, movies); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding created movies", "error", err)
 		}
-		w.WriteHeader(http.StatusCreated)
 
-		log.Println("Received request to create movie")
+		slog.DebugContext(r.Context(), "Received request to bulk create movies", "count", len(movies))
 	}
 }
 
-func updateMovieHandler(db *sql.DB) http.HandlerFunc {
+func updateMovieHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
-		var movieReq MovieRequest
-		if err := json.NewDecoder(r.Body).Decode(&movieReq); err != nil {
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
-			helpers2.ErrorLogger.Println("Error decoding request body:", err)
 			return
 		}
-
-		tx, err := db.Begin()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error starting transaction:", err)
+		var movieReq MovieRequest
+		if err := json.NewDecoder(r.Body).Decode(&movieReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding request body", "error", err)
 			return
 		}
-		defer func() {
-			if err != nil {
-				tx.Rollback()
-				helpers2.ErrorLogger.Println("Transaction rolled back:", err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			err = tx.Commit()
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				helpers2.ErrorLogger.Println("Error committing transaction:", err)
-				return
-			}
-		}()
 
 		var queryArgs []interface{}
-		updateQuery := "UPDATE movies SET"
+		updateQuery := "UPDATE movies SET version=version+1, updated_at=now(),"
 		pIndex := 1
 		if movieReq.Name != "" {
 			if !validation.Name(movieReq.Name) {
@@ -148,79 +196,307 @@ func updateMovieHandler(db *sql.DB) http.HandlerFunc {
 			queryArgs = append(queryArgs, movieReq.ReleaseDate)
 			pIndex++
 		}
-		if movieReq.Rating != "" {
-			if !validation.Rating(movieReq.Rating) {
+		if editorialRating := movieReq.editorialRating(); editorialRating != "" {
+			if !validation.Rating(editorialRating) {
 				http.Error(w, "Invalid movie rating", http.StatusBadRequest)
 				return
 			}
-			updateQuery += " rating=$" + strconv.Itoa(pIndex) + ","
-			queryArgs = append(queryArgs, movieReq.Rating)
+			updateQuery += " editorial_rating=$" + strconv.Itoa(pIndex) + ","
+			queryArgs = append(queryArgs, editorialRating)
 			pIndex++
 		}
 
-		updateQuery = strings.TrimSuffix(updateQuery, ",") + " WHERE movie_id=$" + strconv.Itoa(pIndex)
-		queryArgs = append(queryArgs, r.URL.Query().Get("id"))
-
-		_, err = tx.Exec(updateQuery, queryArgs...)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error updating movie in database:", err)
+		if !validCast(movieReq) {
+			http.Error(w, "Invalid movie cast", http.StatusBadRequest)
+			return
+		}
+		if !validLabels(movieReq.Genres) || !validLabels(movieReq.Tags) {
+			http.Error(w, "Invalid movie genres or tags", http.StatusBadRequest)
 			return
 		}
+		if !validMetadata(movieReq) {
+			http.Error(w, "Invalid movie metadata", http.StatusBadRequest)
+			return
+		}
+		if movieReq.RuntimeMinutes != 0 {
+			updateQuery += " runtime_minutes=$" + strconv.Itoa(pIndex) + ","
+			queryArgs = append(queryArgs, movieReq.RuntimeMinutes)
+			pIndex++
+		}
+		if movieReq.OriginalTitle != "" {
+			updateQuery += " original_title=$" + strconv.Itoa(pIndex) + ","
+			queryArgs = append(queryArgs, movieReq.OriginalTitle)
+			pIndex++
+		}
+		if movieReq.OriginalLanguage != "" {
+			updateQuery += " original_language=$" + strconv.Itoa(pIndex) + ","
+			queryArgs = append(queryArgs, movieReq.OriginalLanguage)
+			pIndex++
+		}
+		if movieReq.Countries != nil {
+			updateQuery += " countries=$" + strconv.Itoa(pIndex) + ","
+			queryArgs = append(queryArgs, pq.Array(movieReq.Countries))
+			pIndex++
+		}
+		if movieReq.Budget != 0 {
+			updateQuery += " budget=$" + strconv.Itoa(pIndex) + ","
+			queryArgs = append(queryArgs, movieReq.Budget)
+			pIndex++
+		}
+		if movieReq.BoxOffice != 0 {
+			updateQuery += " box_office=$" + strconv.Itoa(pIndex) + ","
+			queryArgs = append(queryArgs, movieReq.BoxOffice)
+			pIndex++
+		}
+		if movieReq.ImdbID != "" {
+			updateQuery += " imdb_id=$" + strconv.Itoa(pIndex) + ","
+			queryArgs = append(queryArgs, movieReq.ImdbID)
+			pIndex++
+		}
+		if movieReq.TmdbID != 0 {
+			updateQuery += " tmdb_id=$" + strconv.Itoa(pIndex) + ","
+			queryArgs = append(queryArgs, movieReq.TmdbID)
+			pIndex++
+		}
+
+		updateQuery = strings.TrimSuffix(updateQuery, ",") + " WHERE movie_id=$" + strconv.Itoa(pIndex)
+		queryArgs = append(queryArgs, movieID)
 
-		if len(movieReq.Actors) != 0 {
-			_, err := tx.Exec("DELETE FROM movies_actors WHERE movie_id = $1", r.URL.Query().Get("id"))
+		var movie MovieResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			version, err := lockMovie(r.Context(), tx, movieID)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				helpers2.ErrorLogger.Println("Error deleting movie actors from database:", err)
-				return
+				return err
 			}
-
-			for _, actorName := range movieReq.Actors {
-				var actorID int
-				err := db.QueryRow("SELECT actor_id FROM actors WHERE name=$1", actorName).Scan(&actorID)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					log.Println("Error getting actor ID from database:", err)
-					return
+			if err := checkIfMatch(r, cfg.RequireIfMatch, version); err != nil {
+				return err
+			}
+			if err := ensureExternalIDsFree(r.Context(), tx, movieID, movieReq.ImdbID, movieReq.TmdbID); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(r.Context(), updateQuery, queryArgs...); err != nil {
+				return fmt.Errorf("updating movie: %w", err)
+			}
+			if movieReq.Certifications != nil {
+				if err := setMovieCertifications(r.Context(), tx, movieID, movieReq.Certifications); err != nil {
+					return err
 				}
-
-				_, err = tx.Exec("INSERT INTO movies_actors (movie_id, actor_id) VALUES ($1, $2)", r.URL.Query().Get("id"), actorID)
+			}
+			if len(movieReq.Cast) != 0 {
+				if err := replaceMovieCast(r.Context(), tx, movieID, movieReq.Cast, movieReq.CreateMissingActors); err != nil {
+					return err
+				}
+			} else if len(movieReq.Actors) != 0 {
+				cast, err := loadMovieCast(r.Context(), tx, movieID)
 				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					log.Println("Error inserting movie actor into database:", err)
-					return
+					return err
+				}
+				if err := syncMovieActors(r.Context(), tx, movieID, cast, movieReq.Actors, movieReq.CreateMissingActors, false); err != nil {
+					return err
 				}
 			}
+			if movieReq.Genres != nil {
+				if err := setMovieGenres(r.Context(), tx, movieID, movieReq.Genres); err != nil {
+					return err
+				}
+			}
+			if movieReq.Tags != nil {
+				if err := setMovieTags(r.Context(), tx, movieID, movieReq.Tags); err != nil {
+					return err
+				}
+			}
+			if err := recordRevision(r.Context(), tx, movieEntity, movieID, "update"); err != nil {
+				return err
+			}
+			movie, err = fetchMovie(r.Context(), tx, movieID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error updating movie:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(movie.Version))
+		if err := writeJSON(w, http.StatusOK, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding updated movie", "error", err)
 		}
-		w.WriteHeader(http.StatusOK)
 
-		log.Println("Received request to update movie")
+		slog.DebugContext(r.Context(), "Received request to update movie")
 	}
 }
 
-func deleteMovieHandler(db *sql.DB) http.HandlerFunc {
+func patchMovieHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
-		_, err := db.Exec("DELETE FROM movies_actors WHERE movie_id=$1", r.URL.Query().Get("id"))
+		movieID, err := idFromQuery(r, "id")
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error deleting movie actors from database:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		_, err = db.Exec("DELETE FROM movies WHERE movie_id=$1", r.URL.Query().Get("id"))
+		mediaType, body, err := readPatchBody(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error deleting movie from database:", err)
+			writeError(w, r, err, "Error reading movie patch:")
+			return
+		}
+
+		var movie MovieResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			version, err := lockMovie(r.Context(), tx, movieID)
+			if err != nil {
+				return err
+			}
+			if err := checkIfMatch(r, cfg.RequireIfMatch, version); err != nil {
+				return err
+			}
+			current, cast, err := loadMovieDocument(r.Context(), tx, movieID)
+			if err != nil {
+				return err
+			}
+			var patched movieDocument
+			if err := applyPatch(mediaType, body, current, &patched); err != nil {
+				return err
+			}
+			if err := patched.validate(); err != nil {
+				return err
+			}
+			if err := storeMovieDocument(r.Context(), tx, movieID, patched); err != nil {
+				return err
+			}
+			// The actors of the document are listed in billing order, so a
+			// patch that moves them reorders the cast.
+			if err := syncMovieActors(r.Context(), tx, movieID, cast, patched.Actors, false, true); err != nil {
+				return err
+			}
+			if err := recordRevision(r.Context(), tx, movieEntity, movieID, "update"); err != nil {
+				return err
+			}
+			movie, err = fetchMovie(r.Context(), tx, movieID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error patching movie:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(movie.Version))
+		if err := writeJSON(w, http.StatusOK, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding patched movie", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to patch movie")
+	}
+}
+
+// deleteMovieHandler moves the movie to the trash. Its cast, crew and other
+// links are kept so that restoring it brings them back; the purge job removes
+// them together with the movie once the retention period has passed.
+func deleteMovieHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			version, err := lockMovie(r.Context(), tx, movieID)
+			if err != nil {
+				return err
+			}
+			if err := checkIfMatch(r, cfg.RequireIfMatch, version); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(r.Context(), `UPDATE movies SET deleted_at=now(), version=version+1, updated_at=now()
+				WHERE movie_id=$1`, movieID)
+			if err != nil {
+				return fmt.Errorf("deleting movie: %w", err)
+			}
+			return recordRevision(r.Context(), tx, movieEntity, movieID, "delete")
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting movie from database:")
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
 
-		log.Println("Received request to delete movie")
+		slog.DebugContext(r.Context(), "Received request to delete movie")
+	}
+}
+
+func getMovieHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		movie, err := fetchMovie(r.Context(), db, movieID)
+		if err != nil {
+			writeError(w, r, err, "Error getting movie from database:")
+			return
+		}
+		movies := []MovieResponse{movie}
+		if err := localizeMovies(r.Context(), db, requestLanguages(r), movies); err != nil {
+			writeError(w, r, err, "Error translating movie:")
+			return
+		}
+		movie = movies[0]
+		setLanguageHeaders(w, movie.Language)
+		if err := writeJSONWithETag(w, r, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movie response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get movie")
+	}
+}
+
+// getMovieByExternalIDHandler looks a movie up by its IMDb or TMDb identifier.
+func getMovieByExternalIDHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var filter sqlFilter
+		filter.where("m.deleted_at IS NULL")
+		query := r.URL.Query()
+		switch {
+		case query.Get("imdb_id") != "":
+			filter.where("m.imdb_id = " + filter.arg(query.Get("imdb_id")))
+		case query.Get("tmdb_id") != "":
+			tmdbID, err := idFromQuery(r, "tmdb_id")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			filter.where("m.tmdb_id = " + filter.arg(tmdbID))
+		default:
+			http.Error(w, "missing imdb_id or tmdb_id parameter", http.StatusBadRequest)
+			return
+		}
+
+		movie, err := scanMovie(db.QueryRowContext(r.Context(), `SELECT `+movieColumns+` FROM movies m`+filter.clause(), filter.args...))
+		if err != nil {
+			writeError(w, r, err, "Error getting movie by external ID from database:")
+			return
+		}
+		movies := []MovieResponse{movie}
+		if err := localizeMovies(r.Context(), db, requestLanguages(r), movies); err != nil {
+			writeError(w, r, err, "Error translating movie:")
+			return
+		}
+		movie = movies[0]
+		setLanguageHeaders(w, movie.Language)
+		w.Header().Set("Content-Location", movieLocation(movie.ID))
+		if err := writeJSONWithETag(w, r, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movie response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get movie by external ID")
 	}
 }
 
@@ -230,106 +506,737 @@ func getMoviesHandler(db *sql.DB) http.HandlerFunc {
 		var orderBy string
 		switch sortBy {
 		case "title":
-			orderBy = "name"
+			orderBy = "m.name"
 		case "release_date":
-			orderBy = "release_date"
+			orderBy = "m.release_date"
+		case "user_rating":
+			orderBy = "(" + averageRatingSQL + ")"
+		case "weighted_rating":
+			orderBy = weightedRatingSQL
+		case "votes":
+			orderBy = "(" + voteCountSQL + ")"
 		default:
-			orderBy = "rating"
-		}
-		rows, err := db.Query(`SELECT m.movie_id, m.name, m.description, 
-       			m.release_date, m.rating, array_to_json(array_agg(a.name))
-			FROM movies m 
-			JOIN movies_actors ma ON m.movie_id = ma.movie_id
-    		JOIN actors a ON ma.actor_id = a.actor_id
-			GROUP BY m.movie_id
-			ORDER BY ` + orderBy + ` DESC`)
+			orderBy = "m.editorial_rating"
+		}
+		var filter sqlFilter
+		if err := applyMovieFilters(r, &filter); err != nil {
+			writeError(w, r, err, "Error parsing movie filters:")
+			return
+		}
+		movies, err := queryMovies(r.Context(), db, `SELECT `+movieColumns+`
+			FROM movies m`+filter.clause()+`
+			ORDER BY `+orderBy+` DESC`, filter.args...)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error getting movies from database:", err)
+			slog.ErrorContext(r.Context(), "Error getting movies from database", "error", err)
 			return
 		}
-		defer rows.Close()
-
-		var movies []MovieResponse
-		for rows.Next() {
-			var movie MovieResponse
-			var actorsJSON []byte
-			if err := rows.Scan(&movie.ID, &movie.Name, &movie.Description, &movie.ReleaseDate, &movie.Rating, &actorsJSON); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				helpers2.ErrorLogger.Println("Error scanning movies from database:", err)
-				return
-			}
-			var actors []string
-			if err := json.Unmarshal(actorsJSON, &actors); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				helpers2.ErrorLogger.Println("Error unmarshalling actors JSON:", err)
-				return
-			}
-			movie.Actors = actors
-			movies = append(movies, movie)
+		if err := localizeMovies(r.Context(), db, requestLanguages(r), movies); err != nil {
+			writeError(w, r, err, "Error translating movies:")
+			return
 		}
-		w.Header().Set("Content-Type", "application/json")
+		setLanguageHeaders(w, "")
 
-		json.NewEncoder(w).Encode(movies)
+		if err := writeJSONWithETag(w, r, movies); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movies response", "error", err)
+		}
 
-		log.Println("Received request to get movies")
+		slog.DebugContext(r.Context(), "Received request to get movies")
 	}
 }
 
 func searchMoviesHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		query := r.URL.Query().Get("query")
-		rows, err := db.Query(
-			`SELECT m.movie_id, m.name, m.description, m.release_date, m.rating, 
-       				(
-						SELECT array_to_json(array_agg(a.name))
-						FROM actors a
-						JOIN movies_actors ma ON a.actor_id = ma.actor_id
-						WHERE ma.movie_id=m.movie_id
-       				) AS actors
-					FROM movies m
-					WHERE m.name ILIKE '%' || $1 || '%' OR
-					    EXISTS(
-					        SELECT 1
-					        FROM actors a
-					        JOIN movies_actors ma ON a.actor_id = ma.actor_id
-					        WHERE ma.movie_id = m.movie_id AND a.name ILIKE '%' || $1 || '%'
-					    )
-				`, query)
+		var filter sqlFilter
+		pattern := filter.arg(query)
+		filter.where(`(m.name ILIKE '%' || ` + pattern + ` || '%' OR
+			EXISTS(
+				SELECT 1
+				FROM movie_translations mt
+				WHERE mt.movie_id = m.movie_id AND mt.name ILIKE '%' || ` + pattern + ` || '%'
+			) OR
+			EXISTS(
+				SELECT 1
+				FROM actors a
+				JOIN movies_actors ma ON a.actor_id = ma.actor_id
+				WHERE ma.movie_id = m.movie_id AND a.deleted_at IS NULL AND ` + actorNameMatches(pattern) + `
+			) OR
+			EXISTS(
+				SELECT 1
+				FROM people p
+				JOIN movies_crew mc ON p.person_id = mc.person_id
+				WHERE mc.movie_id = m.movie_id AND p.name ILIKE '%' || ` + pattern + ` || '%'
+			))`)
+		if err := applyMovieFilters(r, &filter); err != nil {
+			writeError(w, r, err, "Error parsing movie filters:")
+			return
+		}
+		movies, err := queryMovies(r.Context(), db, `SELECT `+movieColumns+`
+			FROM movies m`+filter.clause(), filter.args...)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			helpers2.ErrorLogger.Println("Error searching movies in database:", err)
+			slog.ErrorContext(r.Context(), "Error searching movies in database", "error", err)
 			return
 		}
-		defer rows.Close()
-
-		var movies []MovieResponse
-		for rows.Next() {
-			var movie MovieResponse
-			var actorsJSON []byte
-			if err := rows.Scan(&movie.ID, &movie.Name, &movie.Description, &movie.ReleaseDate, &movie.Rating, &actorsJSON); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				helpers2.ErrorLogger.Println("Error scanning searched movies from database:", err)
-				return
-			}
-			var actors []string
-			if err := json.Unmarshal(actorsJSON, &actors); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				helpers2.ErrorLogger.Println("Error unmarshalling actors JSON in searched movies:", err)
-				return
-			}
-			movie.Actors = actors
-			movies = append(movies, movie)
-		}
 		if len(movies) == 0 {
 			http.NotFound(w, r)
 			return
 		}
+		if err := localizeMovies(r.Context(), db, requestLanguages(r), movies); err != nil {
+			writeError(w, r, err, "Error translating movies:")
+			return
+		}
+		setLanguageHeaders(w, "")
+
+		if err := writeJSONWithETag(w, r, movies); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding searched movies", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to search movies", "query", query)
+	}
+}
+
+// editorialRating returns the admin-entered rating, accepting the legacy
+// rating field.
+func (movieReq MovieRequest) editorialRating() string {
+	if movieReq.EditorialRating != "" {
+		return movieReq.EditorialRating
+	}
+	return movieReq.Rating
+}
+
+func validMovieRequest(movieReq MovieRequest) bool {
+	return validation.Name(movieReq.Name) && validation.Description(movieReq.Description) && validation.Rating(movieReq.editorialRating()) &&
+		validCast(movieReq) && validLabels(movieReq.Genres) && validLabels(movieReq.Tags) && validMetadata(movieReq)
+}
+
+// validMetadata checks the extended metadata of a request; zero values mean
+// the field was not provided.
+func validMetadata(movieReq MovieRequest) bool {
+	if movieReq.RuntimeMinutes != 0 && !validation.RuntimeMinutes(movieReq.RuntimeMinutes) {
+		return false
+	}
+	if movieReq.OriginalTitle != "" && !validation.Name(movieReq.OriginalTitle) {
+		return false
+	}
+	if movieReq.OriginalLanguage != "" && !validation.LanguageCode(movieReq.OriginalLanguage) {
+		return false
+	}
+	for _, country := range movieReq.Countries {
+		if !validation.CountryCode(country) {
+			return false
+		}
+	}
+	for country, certification := range movieReq.Certifications {
+		if !validation.CountryCode(country) || !validation.Label(certification) {
+			return false
+		}
+	}
+	if movieReq.Budget < 0 || movieReq.BoxOffice < 0 || movieReq.TmdbID < 0 {
+		return false
+	}
+	return movieReq.ImdbID == "" || validation.ImdbID(movieReq.ImdbID)
+}
+
+// validCast checks the cast entries of a request. Actors and Cast are
+// alternative ways to describe the cast and cannot be combined.
+func validCast(movieReq MovieRequest) bool {
+	if len(movieReq.Actors) != 0 && len(movieReq.Cast) != 0 {
+		return false
+	}
+	for _, ref := range movieReq.Actors {
+		if !ref.valid() {
+			return false
+		}
+	}
+	for _, member := range movieReq.Cast {
+		if !member.actorRef().valid() || member.BillingOrder < 0 {
+			return false
+		}
+		if member.CreditType != "" && !validation.CreditType(member.CreditType) {
+			return false
+		}
+		for _, character := range member.Characters {
+			if !validation.Name(character) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func movieLocation(movieID int) string {
+	return "/movies/get?id=" + strconv.Itoa(movieID)
+}
+
+// insertMovie stores a new movie together with its cast, records its first
+// revision and returns the generated ID.
+func insertMovie(ctx context.Context, tx *sql.Tx, movieReq MovieRequest) (int, error) {
+	if err := ensureExternalIDsFree(ctx, tx, 0, movieReq.ImdbID, movieReq.TmdbID); err != nil {
+		return 0, err
+	}
+	countries := movieReq.Countries
+	if countries == nil {
+		countries = []string{}
+	}
+	var movieID int
+	insertQuery := `INSERT INTO movies (name, description, release_date, editorial_rating, runtime_minutes, original_title,
+			original_language, countries, budget, box_office, imdb_id, tmdb_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), NULLIF($6, ''), NULLIF($7, ''), $8, NULLIF($9, 0), NULLIF($10, 0),
+			NULLIF($11, ''), NULLIF($12, 0))
+		RETURNING movie_id`
+	err := tx.QueryRowContext(ctx, insertQuery, movieReq.Name, movieReq.Description, movieReq.ReleaseDate, movieReq.editorialRating(),
+		movieReq.RuntimeMinutes, movieReq.OriginalTitle, movieReq.OriginalLanguage, pq.Array(countries), movieReq.Budget,
+		movieReq.BoxOffice, movieReq.ImdbID, movieReq.TmdbID).Scan(&movieID)
+	if err != nil {
+		return 0, fmt.Errorf("inserting movie: %w", err)
+	}
+	if err := setMovieCertifications(ctx, tx, movieID, movieReq.Certifications); err != nil {
+		return 0, err
+	}
+	if err := setMovieGenres(ctx, tx, movieID, movieReq.Genres); err != nil {
+		return 0, err
+	}
+	if err := setMovieTags(ctx, tx, movieID, movieReq.Tags); err != nil {
+		return 0, err
+	}
+	if len(movieReq.Cast) != 0 {
+		if err := replaceMovieCast(ctx, tx, movieID, movieReq.Cast, movieReq.CreateMissingActors); err != nil {
+			return 0, err
+		}
+	} else {
+		actorIDs, err := resolveActorRefs(ctx, tx, movieReq.Actors, movieReq.CreateMissingActors)
+		if err != nil {
+			return 0, err
+		}
+		if err := linkMovieActors(ctx, tx, movieID, actorIDs); err != nil {
+			return 0, err
+		}
+	}
+	if err := recordRevision(ctx, tx, movieEntity, movieID, "create"); err != nil {
+		return 0, err
+	}
+	return movieID, nil
+}
 
-		w.Header().Set("Content-Type", "application/json")
+func (member CastMemberRequest) actorRef() ActorRef {
+	return ActorRef{ID: member.ActorID, Name: member.Name}
+}
 
-		json.NewEncoder(w).Encode(movies)
+// replaceMovieCast makes cast the complete cast of the movie, keeping the
+// links of actors that stay and updating their credits.
+func replaceMovieCast(ctx context.Context, tx *sql.Tx, movieID int, cast []CastMemberRequest, createMissing bool) error {
+	refs := make([]ActorRef, len(cast))
+	for i, member := range cast {
+		refs[i] = member.actorRef()
+	}
+	actorIDs, err := resolveActorRefs(ctx, tx, refs, createMissing)
+	if err != nil {
+		return err
+	}
+	seen := make(map[int]bool, len(actorIDs))
+	for _, actorID := range actorIDs {
+		if seen[actorID] {
+			return newStatusError(http.StatusUnprocessableEntity, "actor %d is listed more than once in the cast", actorID)
+		}
+		seen[actorID] = true
+	}
+	// Links to actors in the trash are kept so that restoring them brings the credit back.
+	_, err = tx.ExecContext(ctx, `DELETE FROM movies_actors WHERE movie_id = $1 AND NOT (actor_id = ANY($2))
+		AND actor_id NOT IN (SELECT actor_id FROM actors WHERE deleted_at IS NOT NULL)`,
+		movieID, pq.Array(actorIDs))
+	if err != nil {
+		return fmt.Errorf("deleting movie actors: %w", err)
+	}
 
-		log.Printf("Received request to search movies with query: %s\n", query)
+	for i, member := range cast {
+		billingOrder := member.BillingOrder
+		if billingOrder == 0 {
+			billingOrder = i + 1
+		}
+		characters := member.Characters
+		if characters == nil {
+			characters = []string{}
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO movies_actors (movie_id, actor_id, characters, billing_order, credit_type)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+			ON CONFLICT (movie_id, actor_id) DO UPDATE
+			SET characters = EXCLUDED.characters, billing_order = EXCLUDED.billing_order, credit_type = EXCLUDED.credit_type`,
+			movieID, actorIDs[i], pq.Array(characters), billingOrder, member.CreditType)
+		if err != nil {
+			return fmt.Errorf("upserting movie actor: %w", err)
+		}
+	}
+	return nil
+}
+
+func linkMovieActors(ctx context.Context, tx *sql.Tx, movieID int, actorIDs []int) error {
+	for _, actorID := range actorIDs {
+		_, err := tx.ExecContext(ctx, `INSERT INTO movies_actors (movie_id, actor_id, billing_order)
+			SELECT $1, $2, COALESCE(MAX(billing_order), 0) + 1 FROM movies_actors WHERE movie_id = $1
+			ON CONFLICT (movie_id, actor_id) DO NOTHING`, movieID, actorID)
+		if err != nil {
+			return fmt.Errorf("inserting movie actor: %w", err)
+		}
+	}
+	return nil
+}
+
+// movieFranchiseSQL is the franchise of the movie aliased as m, with its
+// neighbours in the franchise, as JSON.
+const movieFranchiseSQL = `COALESCE((
+	SELECT json_build_object(
+		'id', f.franchise_id,
+		'name', f.name,
+		'position', fm.position,
+		'previous', (
+			SELECT json_build_object('movie_id', pm.movie_id, 'name', pm.name)
+			FROM franchise_movies pfm
+			JOIN movies pm ON pm.movie_id = pfm.movie_id AND pm.deleted_at IS NULL
+			WHERE pfm.franchise_id = fm.franchise_id AND pfm.position < fm.position
+			ORDER BY pfm.position DESC
+			LIMIT 1
+		),
+		'next', (
+			SELECT json_build_object('movie_id', nm.movie_id, 'name', nm.name)
+			FROM franchise_movies nfm
+			JOIN movies nm ON nm.movie_id = nfm.movie_id AND nm.deleted_at IS NULL
+			WHERE nfm.franchise_id = fm.franchise_id AND nfm.position > fm.position
+			ORDER BY nfm.position
+			LIMIT 1
+		)
+	)
+	FROM franchise_movies fm
+	JOIN franchises f ON f.franchise_id = fm.franchise_id
+	WHERE fm.movie_id = m.movie_id
+), 'null')`
+
+// movieColumns is the select list, over movies aliased as m, shared by every
+// query that is scanned with scanMovie.
+const movieColumns = `m.movie_id, m.name, COALESCE(m.description, ''),
+	COALESCE(to_char(m.release_date, 'YYYY-MM-DD'), ''), COALESCE(m.editorial_rating, 0),
+	COALESCE((
+		SELECT array_to_json(array_agg(a.name ORDER BY ma.billing_order NULLS LAST, a.name))
+		FROM actors a
+		JOIN movies_actors ma ON a.actor_id = ma.actor_id
+		WHERE ma.movie_id = m.movie_id AND a.deleted_at IS NULL
+	), '[]'),
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'actor_id', a.actor_id,
+			'name', a.name,
+			'characters', ma.characters,
+			'billing_order', ma.billing_order,
+			'credit_type', ma.credit_type
+		) ORDER BY ma.billing_order NULLS LAST, a.name)
+		FROM actors a
+		JOIN movies_actors ma ON a.actor_id = ma.actor_id
+		WHERE ma.movie_id = m.movie_id AND a.deleted_at IS NULL
+	), '[]'),
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'person_id', p.person_id,
+			'name', p.name,
+			'role', mc.role
+		) ORDER BY mc.role, p.name)
+		FROM people p
+		JOIN movies_crew mc ON p.person_id = mc.person_id
+		WHERE mc.movie_id = m.movie_id
+	), '[]'),
+	COALESCE((
+		SELECT array_to_json(array_agg(g.name ORDER BY g.name))
+		FROM genres g
+		JOIN movies_genres mg ON g.genre_id = mg.genre_id
+		WHERE mg.movie_id = m.movie_id
+	), '[]'),
+	COALESCE((SELECT array_to_json(array_agg(mt.tag ORDER BY mt.tag)) FROM movie_tags mt WHERE mt.movie_id = m.movie_id), '[]'),
+	COALESCE(m.runtime_minutes, 0), COALESCE(m.original_title, ''), COALESCE(m.original_language, ''),
+	array_to_json(m.countries),
+	COALESCE((
+		SELECT json_object_agg(mcert.country, mcert.certification)
+		FROM movie_certifications mcert
+		WHERE mcert.movie_id = m.movie_id
+	), '{}'),
+	COALESCE(m.budget, 0), COALESCE(m.box_office, 0), COALESCE(m.imdb_id, ''), COALESCE(m.tmdb_id, 0),
+	COALESCE((` + averageRatingSQL + `), 0), (` + voteCountSQL + `), ` + weightedRatingSQL + `,
+	` + movieFranchiseSQL + `,
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'movie_id', rm.movie_id,
+			'name', rm.name,
+			'relation', rel.relation
+		) ORDER BY rm.release_date NULLS LAST, rm.movie_id)
+		FROM (
+			SELECT related_movie_id AS movie_id, relation FROM movie_relations WHERE movie_id = m.movie_id
+			UNION ALL
+			SELECT movie_id, CASE relation WHEN 'sequel' THEN 'prequel' ELSE 'original' END
+			FROM movie_relations
+			WHERE related_movie_id = m.movie_id
+		) rel
+		JOIN movies rm ON rm.movie_id = rel.movie_id AND rm.deleted_at IS NULL
+	), '[]'),
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'kind', i.kind,
+			'key', i.storage_key,
+			'content_type', i.content_type,
+			'width', i.width,
+			'height', i.height
+		))
+		FROM images i
+		WHERE i.movie_id = m.movie_id
+	), '[]'),
+	m.version, m.updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMovie(row rowScanner) (MovieResponse, error) {
+	var movie MovieResponse
+	var actorsJSON, castJSON, crewJSON, genresJSON, tagsJSON, countriesJSON, certificationsJSON, franchiseJSON, relationsJSON, imagesJSON []byte
+	err := row.Scan(&movie.ID, &movie.Name, &movie.Description, &movie.ReleaseDate, &movie.EditorialRating, &actorsJSON,
+		&castJSON, &crewJSON, &genresJSON, &tagsJSON, &movie.RuntimeMinutes, &movie.OriginalTitle, &movie.OriginalLanguage,
+		&countriesJSON, &certificationsJSON, &movie.Budget, &movie.BoxOffice, &movie.ImdbID, &movie.TmdbID,
+		&movie.Rating, &movie.VoteCount, &movie.WeightedRating, &franchiseJSON, &relationsJSON,
+		&imagesJSON, &movie.Version, &movie.UpdatedAt)
+	if err != nil {
+		return movie, err
+	}
+	if err := json.Unmarshal(actorsJSON, &movie.Actors); err != nil {
+		return movie, fmt.Errorf("unmarshalling actors JSON: %w", err)
+	}
+	if err := json.Unmarshal(castJSON, &movie.Cast); err != nil {
+		return movie, fmt.Errorf("unmarshalling cast JSON: %w", err)
+	}
+	if err := json.Unmarshal(crewJSON, &movie.Crew); err != nil {
+		return movie, fmt.Errorf("unmarshalling crew JSON: %w", err)
+	}
+	if err := json.Unmarshal(genresJSON, &movie.Genres); err != nil {
+		return movie, fmt.Errorf("unmarshalling genres JSON: %w", err)
+	}
+	if err := json.Unmarshal(tagsJSON, &movie.Tags); err != nil {
+		return movie, fmt.Errorf("unmarshalling tags JSON: %w", err)
+	}
+	if err := json.Unmarshal(countriesJSON, &movie.Countries); err != nil {
+		return movie, fmt.Errorf("unmarshalling countries JSON: %w", err)
+	}
+	if err := json.Unmarshal(certificationsJSON, &movie.Certifications); err != nil {
+		return movie, fmt.Errorf("unmarshalling certifications JSON: %w", err)
+	}
+	if err := json.Unmarshal(franchiseJSON, &movie.Franchise); err != nil {
+		return movie, fmt.Errorf("unmarshalling franchise JSON: %w", err)
+	}
+	if err := json.Unmarshal(relationsJSON, &movie.Relations); err != nil {
+		return movie, fmt.Errorf("unmarshalling relations JSON: %w", err)
+	}
+	images, err := imagesByKind(imagesJSON)
+	if err != nil {
+		return movie, err
+	}
+	movie.Poster, movie.Backdrop = images["poster"], images["backdrop"]
+	return movie, nil
+}
+
+func queryMovies(ctx context.Context, q queryer, query string, args ...interface{}) ([]MovieResponse, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []MovieResponse{}
+	for rows.Next() {
+		movie, err := scanMovie(rows)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, movie)
+	}
+	return movies, rows.Err()
+}
+
+// fetchMovie reads the persisted representation of a single movie.
+func fetchMovie(ctx context.Context, q queryer, movieID int) (MovieResponse, error) {
+	return scanMovie(q.QueryRowContext(ctx, `SELECT `+movieColumns+` FROM movies m
+		WHERE m.movie_id = $1 AND m.deleted_at IS NULL`, movieID))
+}
+
+// lockMovie locks the movie row for the rest of the transaction and returns its version.
+func lockMovie(ctx context.Context, tx *sql.Tx, movieID int) (int, error) {
+	var version int
+	err := tx.QueryRowContext(ctx, "SELECT version FROM movies WHERE movie_id = $1 AND deleted_at IS NULL FOR UPDATE",
+		movieID).Scan(&version)
+	return version, err
+}
+
+// movieDocument is the representation of a movie that PATCH requests operate
+// on. Nil fields are stored as NULL.
+type movieDocument struct {
+	Name            *string      `json:"name"`
+	Description     *string      `json:"description"`
+	ReleaseDate     *string      `json:"release_date"`
+	EditorialRating *json.Number `json:"editorial_rating"`
+	Actors          []ActorRef   `json:"actors"`
+	Genres          []string     `json:"genres"`
+	Tags            []string     `json:"tags"`
+
+	RuntimeMinutes   *int              `json:"runtime_minutes"`
+	OriginalTitle    *string           `json:"original_title"`
+	OriginalLanguage *string           `json:"original_language"`
+	Countries        []string          `json:"countries"`
+	Certifications   map[string]string `json:"certifications"`
+	Budget           *int64            `json:"budget"`
+	BoxOffice        *int64            `json:"box_office"`
+	ImdbID           *string           `json:"imdb_id"`
+	TmdbID           *int              `json:"tmdb_id"`
+}
+
+type castLink struct {
+	ActorID int
+	Name    string
+}
+
+func (d movieDocument) validate() error {
+	if d.Name == nil || !validation.Name(*d.Name) {
+		return newStatusError(http.StatusUnprocessableEntity, "Invalid movie name")
+	}
+	if d.Description != nil && !validation.Description(*d.Description) {
+		return newStatusError(http.StatusUnprocessableEntity, "Invalid movie description")
+	}
+	if d.ReleaseDate != nil && !validation.Date(*d.ReleaseDate) {
+		return newStatusError(http.StatusUnprocessableEntity, "Invalid movie release date")
+	}
+	if d.EditorialRating != nil && !validation.Rating(d.EditorialRating.String()) {
+		return newStatusError(http.StatusUnprocessableEntity, "Invalid movie rating")
+	}
+	for _, ref := range d.Actors {
+		if !ref.valid() {
+			return newStatusError(http.StatusUnprocessableEntity, "Invalid actor reference")
+		}
+	}
+	if !validLabels(d.Genres) || !validLabels(d.Tags) {
+		return newStatusError(http.StatusUnprocessableEntity, "Invalid movie genres or tags")
+	}
+	metadata := MovieRequest{
+		RuntimeMinutes:   intValue(d.RuntimeMinutes),
+		OriginalTitle:    stringValue(d.OriginalTitle),
+		OriginalLanguage: stringValue(d.OriginalLanguage),
+		Countries:        d.Countries,
+		Certifications:   d.Certifications,
+		ImdbID:           stringValue(d.ImdbID),
+		TmdbID:           intValue(d.TmdbID),
+	}
+	if d.Budget != nil {
+		metadata.Budget = *d.Budget
+	}
+	if d.BoxOffice != nil {
+		metadata.BoxOffice = *d.BoxOffice
+	}
+	invalidZero := (d.RuntimeMinutes != nil && *d.RuntimeMinutes == 0) || (d.TmdbID != nil && *d.TmdbID == 0) ||
+		(d.OriginalTitle != nil && *d.OriginalTitle == "") || (d.OriginalLanguage != nil && *d.OriginalLanguage == "") ||
+		(d.ImdbID != nil && *d.ImdbID == "")
+	if invalidZero || !validMetadata(metadata) {
+		return newStatusError(http.StatusUnprocessableEntity, "Invalid movie metadata")
+	}
+	return nil
+}
+
+// loadMovieDocument returns the patchable representation of a movie together
+// with its current cast.
+func loadMovieDocument(ctx context.Context, tx *sql.Tx, movieID int) (movieDocument, []castLink, error) {
+	var doc movieDocument
+	var name string
+	var description, releaseDate, originalTitle, originalLanguage, imdbID sql.NullString
+	var rating sql.NullFloat64
+	var runtimeMinutes, budget, boxOffice, tmdbID sql.NullInt64
+	var certificationsJSON []byte
+	err := tx.QueryRowContext(ctx, `SELECT name, description, to_char(release_date, 'YYYY-MM-DD'), editorial_rating,
+			runtime_minutes, original_title, original_language, countries, budget, box_office, imdb_id, tmdb_id,
+			COALESCE((SELECT json_object_agg(country, certification) FROM movie_certifications WHERE movie_id = $1), '{}')
+		FROM movies WHERE movie_id = $1`, movieID).
+		Scan(&name, &description, &releaseDate, &rating, &runtimeMinutes, &originalTitle, &originalLanguage,
+			pq.Array(&doc.Countries), &budget, &boxOffice, &imdbID, &tmdbID, &certificationsJSON)
+	if err != nil {
+		return doc, nil, err
+	}
+	if err := json.Unmarshal(certificationsJSON, &doc.Certifications); err != nil {
+		return doc, nil, fmt.Errorf("unmarshalling certifications JSON: %w", err)
+	}
+	if runtimeMinutes.Valid {
+		minutes := int(runtimeMinutes.Int64)
+		doc.RuntimeMinutes = &minutes
+	}
+	if originalTitle.Valid {
+		doc.OriginalTitle = &originalTitle.String
+	}
+	if originalLanguage.Valid {
+		doc.OriginalLanguage = &originalLanguage.String
+	}
+	if budget.Valid {
+		doc.Budget = &budget.Int64
+	}
+	if boxOffice.Valid {
+		doc.BoxOffice = &boxOffice.Int64
+	}
+	if imdbID.Valid {
+		doc.ImdbID = &imdbID.String
+	}
+	if tmdbID.Valid {
+		id := int(tmdbID.Int64)
+		doc.TmdbID = &id
+	}
+	doc.Name = &name
+	if description.Valid {
+		doc.Description = &description.String
+	}
+	if releaseDate.Valid {
+		doc.ReleaseDate = &releaseDate.String
+	}
+	if rating.Valid {
+		number := json.Number(strconv.FormatFloat(rating.Float64, 'f', -1, 64))
+		doc.EditorialRating = &number
+	}
+
+	cast, err := loadMovieCast(ctx, tx, movieID)
+	if err != nil {
+		return doc, nil, err
+	}
+	doc.Actors = []ActorRef{}
+	for _, link := range cast {
+		doc.Actors = append(doc.Actors, ActorRef{ID: link.ActorID, Name: link.Name})
+	}
+
+	doc.Genres = []string{}
+	doc.Tags = []string{}
+	err = tx.QueryRowContext(ctx, `SELECT
+			COALESCE((SELECT array_agg(g.name ORDER BY g.name) FROM genres g
+				JOIN movies_genres mg ON g.genre_id = mg.genre_id WHERE mg.movie_id = $1), '{}'),
+			COALESCE((SELECT array_agg(tag ORDER BY tag) FROM movie_tags WHERE movie_id = $1), '{}')`, movieID).
+		Scan(pq.Array(&doc.Genres), pq.Array(&doc.Tags))
+	if err != nil {
+		return doc, nil, fmt.Errorf("reading movie genres and tags: %w", err)
+	}
+	return doc, cast, nil
+}
+
+func loadMovieCast(ctx context.Context, tx *sql.Tx, movieID int) ([]castLink, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT a.actor_id, a.name FROM actors a
+		JOIN movies_actors ma ON a.actor_id = ma.actor_id
+		WHERE ma.movie_id = $1 AND a.deleted_at IS NULL ORDER BY ma.billing_order NULLS LAST, a.name`, movieID)
+	if err != nil {
+		return nil, fmt.Errorf("reading movie actors: %w", err)
+	}
+	defer rows.Close()
+
+	var cast []castLink
+	for rows.Next() {
+		var link castLink
+		if err := rows.Scan(&link.ActorID, &link.Name); err != nil {
+			return nil, fmt.Errorf("scanning movie actors: %w", err)
+		}
+		cast = append(cast, link)
+	}
+	return cast, rows.Err()
+}
+
+// syncMovieActors brings the movie's cast in line with refs, removing and
+// adding only the links that changed. When ordered is set, the actors are
+// billed in the order of refs; otherwise new ones are billed last.
+func syncMovieActors(ctx context.Context, tx *sql.Tx, movieID int, current []castLink, refs []ActorRef, createMissing, ordered bool) error {
+	actorIDs, err := resolveActorRefs(ctx, tx, refs, createMissing)
+	if err != nil {
+		return err
+	}
+	wanted := make(map[int]bool, len(actorIDs))
+	for _, actorID := range actorIDs {
+		wanted[actorID] = true
+	}
+	for _, link := range current {
+		if wanted[link.ActorID] {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM movies_actors WHERE movie_id = $1 AND actor_id = $2", movieID, link.ActorID)
+		if err != nil {
+			return fmt.Errorf("deleting movie actor: %w", err)
+		}
+	}
+
+	if err := linkMovieActors(ctx, tx, movieID, actorIDs); err != nil {
+		return err
+	}
+	if ordered {
+		for position, actorID := range actorIDs {
+			_, err := tx.ExecContext(ctx, `UPDATE movies_actors SET billing_order = $1
+				WHERE movie_id = $2 AND actor_id = $3 AND billing_order IS DISTINCT FROM $1`, position+1, movieID, actorID)
+			if err != nil {
+				return fmt.Errorf("updating billing order: %w", err)
+			}
+		}
+	}
+	return renumberBilling(ctx, tx, movieID)
+}
+
+// storeMovieDocument writes every field of a validated movie document except
+// its cast and bumps the movie version.
+func storeMovieDocument(ctx context.Context, tx *sql.Tx, movieID int, doc movieDocument) error {
+	if doc.Countries == nil {
+		doc.Countries = []string{}
+	}
+	if err := ensureExternalIDsFree(ctx, tx, movieID, stringValue(doc.ImdbID), intValue(doc.TmdbID)); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx,
+		`UPDATE movies SET name=$1, description=$2, release_date=$3, editorial_rating=$4, runtime_minutes=$5,
+			original_title=$6, original_language=$7, countries=$8, budget=$9, box_office=$10, imdb_id=$11, tmdb_id=$12,
+			version=version+1, updated_at=now()
+		WHERE movie_id=$13`,
+		doc.Name, doc.Description, doc.ReleaseDate, doc.EditorialRating, doc.RuntimeMinutes,
+		doc.OriginalTitle, doc.OriginalLanguage, pq.Array(doc.Countries), doc.Budget, doc.BoxOffice,
+		doc.ImdbID, doc.TmdbID, movieID)
+	if err != nil {
+		return fmt.Errorf("updating movie: %w", err)
+	}
+	if err := setMovieCertifications(ctx, tx, movieID, doc.Certifications); err != nil {
+		return err
+	}
+	if err := setMovieGenres(ctx, tx, movieID, doc.Genres); err != nil {
+		return err
+	}
+	return setMovieTags(ctx, tx, movieID, doc.Tags)
+}
+
+// ensureExternalIDsFree rejects external IDs that already belong to a movie
+// other than movieID with 409 Conflict.
+func ensureExternalIDsFree(ctx context.Context, tx *sql.Tx, movieID int, imdbID string, tmdbID int) error {
+	if imdbID == "" && tmdbID == 0 {
+		return nil
+	}
+	var conflictID int
+	err := tx.QueryRowContext(ctx, `SELECT movie_id FROM movies
+		WHERE movie_id <> $1 AND ((imdb_id = $2 AND $2 <> '') OR (tmdb_id = $3 AND $3 <> 0))
+		LIMIT 1`, movieID, imdbID, tmdbID).Scan(&conflictID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checking external IDs: %w", err)
+	}
+	return newStatusError(http.StatusConflict, "external ID already belongs to movie %d", conflictID)
+}
+
+// setMovieCertifications replaces the age certifications of a movie.
+func setMovieCertifications(ctx context.Context, tx *sql.Tx, movieID int, certifications map[string]string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM movie_certifications WHERE movie_id = $1", movieID); err != nil {
+		return fmt.Errorf("deleting movie certifications: %w", err)
+	}
+	for country, certification := range certifications {
+		_, err := tx.ExecContext(ctx, "INSERT INTO movie_certifications (movie_id, country, certification) VALUES ($1, $2, $3)",
+			movieID, country, certification)
+		if err != nil {
+			return fmt.Errorf("inserting movie certification: %w", err)
+		}
 	}
+	return nil
 }
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"movieLibrary/internal/pkg/jsonpatch"
+	"net/http"
+)
+
+// patchMediaType returns the patch format requested by the client, or a 415
+// status error when the Content-Type is not one of the supported patch formats.
+func patchMediaType(r *http.Request) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case jsonpatch.MergePatchContentType, jsonpatch.JSONPatchContentType:
+		return mediaType, nil
+	default:
+		return "", newStatusError(http.StatusUnsupportedMediaType,
+			"Content-Type must be %s or %s", jsonpatch.MergePatchContentType, jsonpatch.JSONPatchContentType)
+	}
+}
+
+// applyPatch applies the patch in body to the JSON representation of current
+// and decodes the patched document into target.
+func applyPatch(mediaType string, body []byte, current interface{}, target interface{}) error {
+	raw, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+
+	switch mediaType {
+	case jsonpatch.MergePatchContentType:
+		var patch interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return newStatusError(http.StatusBadRequest, "Invalid merge patch: %v", err)
+		}
+		doc = jsonpatch.MergePatch(doc, patch)
+	case jsonpatch.JSONPatchContentType:
+		var ops []jsonpatch.Operation
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return newStatusError(http.StatusBadRequest, "Invalid JSON patch: %v", err)
+		}
+		doc, err = jsonpatch.Apply(doc, ops)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return newStatusError(http.StatusConflict, "%v", err)
+		}
+		if err != nil {
+			return newStatusError(http.StatusUnprocessableEntity, "%v", err)
+		}
+	}
+
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return newStatusError(http.StatusUnprocessableEntity, "Invalid patched document: %v", err)
+	}
+	return nil
+}
+
+func readPatchBody(r *http.Request) (string, []byte, error) {
+	mediaType, err := patchMediaType(r)
+	if err != nil {
+		return "", nil, err
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", nil, newStatusError(http.StatusBadRequest, "Error reading request body: %v", err)
+	}
+	return mediaType, body, nil
+}
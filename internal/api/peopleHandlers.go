@@ -0,0 +1,365 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"movieLibrary/internal/config"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/validation"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type PersonRequest struct {
+	Name        string `json:"name,omitempty"`
+	DateOfBirth string `json:"date_of_birth,omitempty"`
+}
+
+type CrewRequest struct {
+	PersonID int    `json:"person_id"`
+	Role     string `json:"role"`
+}
+
+func createPersonHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var personReq PersonRequest
+		if err := json.NewDecoder(r.Body).Decode(&personReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding person request on creating", "error", err)
+			return
+		}
+		if !validation.Name(personReq.Name) || (personReq.DateOfBirth != "" && !validation.Date(personReq.DateOfBirth)) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var person PersonResponse
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			var personID int
+			err := tx.QueryRowContext(r.Context(), `INSERT INTO people (name, date_of_birth)
+				VALUES ($1, NULLIF($2, '')::date) RETURNING person_id`, personReq.Name, personReq.DateOfBirth).Scan(&personID)
+			if err != nil {
+				return fmt.Errorf("inserting person: %w", err)
+			}
+			person, err = fetchPerson(r.Context(), tx, personID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error creating person:")
+			return
+		}
+
+		w.Header().Set("Location", "/people/get?id="+strconv.Itoa(person.ID))
+		if err := writeJSON(w, http.StatusCreated, person); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding created person", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to create person")
+	}
+}
+
+func updatePersonHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		personID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var personReq PersonRequest
+		if err := json.NewDecoder(r.Body).Decode(&personReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding person request on updating", "error", err)
+			return
+		}
+
+		var queryArgs []interface{}
+		updateQuery := "UPDATE people SET"
+		pIndex := 1
+		if personReq.Name != "" {
+			if !validation.Name(personReq.Name) {
+				http.Error(w, "Invalid person name", http.StatusBadRequest)
+				return
+			}
+			updateQuery += " name=$" + strconv.Itoa(pIndex) + ","
+			queryArgs = append(queryArgs, personReq.Name)
+			pIndex++
+		}
+		if personReq.DateOfBirth != "" {
+			if !validation.Date(personReq.DateOfBirth) {
+				http.Error(w, "Invalid person date of birth", http.StatusBadRequest)
+				return
+			}
+			updateQuery += " date_of_birth=$" + strconv.Itoa(pIndex) + ","
+			queryArgs = append(queryArgs, personReq.DateOfBirth)
+			pIndex++
+		}
+		if len(queryArgs) == 0 {
+			http.Error(w, "Nothing to update", http.StatusBadRequest)
+			return
+		}
+
+		updateQuery = strings.TrimSuffix(updateQuery, ",") + " WHERE person_id=$" + strconv.Itoa(pIndex)
+		queryArgs = append(queryArgs, personID)
+
+		var person PersonResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(r.Context(), updateQuery, queryArgs...); err != nil {
+				return fmt.Errorf("updating person: %w", err)
+			}
+			var err error
+			person, err = fetchPerson(r.Context(), tx, personID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error updating person:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, person); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding updated person", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to update person")
+	}
+}
+
+func deletePersonHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		personID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(r.Context(), "DELETE FROM movies_crew WHERE person_id=$1", personID); err != nil {
+				return fmt.Errorf("deleting crew credits: %w", err)
+			}
+			result, err := tx.ExecContext(r.Context(), "DELETE FROM people WHERE person_id=$1", personID)
+			if err != nil {
+				return fmt.Errorf("deleting person: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting person:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete person")
+	}
+}
+
+func getPersonHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		personID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		person, err := fetchPerson(r.Context(), db, personID)
+		if err != nil {
+			writeError(w, r, err, "Error getting person from database:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, person); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding person response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get person")
+	}
+}
+
+func getPeopleHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var filter sqlFilter
+		if role := r.URL.Query().Get("role"); role != "" {
+			if !validation.CrewRole(role) {
+				http.Error(w, "invalid role parameter", http.StatusBadRequest)
+				return
+			}
+			filter.where("EXISTS (SELECT 1 FROM movies_crew mc WHERE mc.person_id = p.person_id AND mc.role = " + filter.arg(role) + ")")
+		}
+		if name := r.URL.Query().Get("name"); name != "" {
+			filter.where("p.name ILIKE '%' || " + filter.arg(name) + " || '%'")
+		}
+
+		rows, err := db.QueryContext(r.Context(), `SELECT `+personColumns+` FROM people p`+filter.clause()+` ORDER BY p.name`,
+			filter.args...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting people from database", "error", err)
+			return
+		}
+		defer rows.Close()
+
+		people := []PersonResponse{}
+		for rows.Next() {
+			person, err := scanPerson(rows)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Error scanning people", "error", err)
+				return
+			}
+			people = append(people, person)
+		}
+
+		if err := writeJSONWithETag(w, r, people); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding people response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get people")
+	}
+}
+
+// addMovieCrewHandler credits a person on a movie in the given role. Adding
+// an existing credit again has no effect.
+func addMovieCrewHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var crewReq CrewRequest
+		if err := json.NewDecoder(r.Body).Decode(&crewReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding crew request", "error", err)
+			return
+		}
+		if crewReq.PersonID <= 0 || !validation.CrewRole(crewReq.Role) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		movie, err := editMovie(r, db, cfg, movieID, func(tx *sql.Tx) error {
+			var exists bool
+			err := tx.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM people WHERE person_id = $1)", crewReq.PersonID).
+				Scan(&exists)
+			if err != nil {
+				return fmt.Errorf("checking person: %w", err)
+			}
+			if !exists {
+				return newStatusError(http.StatusUnprocessableEntity, "person %d does not exist", crewReq.PersonID)
+			}
+			_, err = tx.ExecContext(r.Context(), `INSERT INTO movies_crew (movie_id, person_id, role) VALUES ($1, $2, $3)
+				ON CONFLICT DO NOTHING`, movieID, crewReq.PersonID, crewReq.Role)
+			if err != nil {
+				return fmt.Errorf("inserting crew credit: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error adding crew to movie:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(movie.Version))
+		if err := writeJSON(w, http.StatusOK, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movie response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to add crew to movie")
+	}
+}
+
+// removeMovieCrewHandler removes a person's credit from a movie. Without a
+// role parameter all of the person's credits on the movie are removed.
+func removeMovieCrewHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		personID, err := idFromQuery(r, "person_id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		role := r.URL.Query().Get("role")
+		if role != "" && !validation.CrewRole(role) {
+			http.Error(w, "invalid role parameter", http.StatusBadRequest)
+			return
+		}
+
+		movie, err := editMovie(r, db, cfg, movieID, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(r.Context(), `DELETE FROM movies_crew
+				WHERE movie_id = $1 AND person_id = $2 AND ($3 = '' OR role = $3)`, movieID, personID, role)
+			if err != nil {
+				return fmt.Errorf("deleting crew credit: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error removing crew from movie:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(movie.Version))
+		if err := writeJSON(w, http.StatusOK, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movie response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to remove crew from movie")
+	}
+}
+
+// personColumns is the select list, over people aliased as p, scanned by scanPerson.
+const personColumns = `p.person_id, p.name, COALESCE(to_char(p.date_of_birth, 'YYYY-MM-DD'), ''),
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'movie_id', m.movie_id,
+			'name', m.name,
+			'role', mc.role
+		) ORDER BY m.release_date NULLS LAST, m.name)
+		FROM movies m
+		JOIN movies_crew mc ON m.movie_id = mc.movie_id
+		WHERE mc.person_id = p.person_id AND m.deleted_at IS NULL
+	), '[]')`
+
+func scanPerson(row rowScanner) (PersonResponse, error) {
+	var person PersonResponse
+	var creditsJSON []byte
+	if err := row.Scan(&person.ID, &person.Name, &person.DateOfBirth, &creditsJSON); err != nil {
+		return person, err
+	}
+	if err := json.Unmarshal(creditsJSON, &person.Credits); err != nil {
+		return person, fmt.Errorf("unmarshalling credits JSON: %w", err)
+	}
+	return person, nil
+}
+
+func fetchPerson(ctx context.Context, q queryer, personID int) (PersonResponse, error) {
+	return scanPerson(q.QueryRowContext(ctx, `SELECT `+personColumns+` FROM people p WHERE p.person_id = $1`, personID))
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"net/http"
+)
+
+// averageRatingSQL, voteCountSQL and weightedRatingSQL compute the rating
+// aggregates of the movie aliased as m. The weighted rating is a Bayesian
+// average that assumes every movie starts with 10 votes at the catalog-wide
+// average, so that movies with only a few votes are pulled towards it.
+const (
+	averageRatingSQL = `SELECT AVG(mr.score)::float8 FROM movie_ratings mr WHERE mr.movie_id = m.movie_id`
+	voteCountSQL     = `SELECT COUNT(*) FROM movie_ratings mr WHERE mr.movie_id = m.movie_id`
+
+	weightedRatingSQL = `(
+		SELECT (COALESCE(SUM(mr.score), 0) + 10 * COALESCE((SELECT AVG(score) FROM movie_ratings), 0))::float8
+			/ (COUNT(mr.score) + 10)
+		FROM movie_ratings mr
+		WHERE mr.movie_id = m.movie_id
+	)`
+)
+
+type RatingRequest struct {
+	Score *float64 `json:"score"`
+}
+
+// rateMovieHandler creates or replaces the authenticated user's rating of a movie.
+func rateMovieHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := helpers2.GetUsernameFromContext(r.Context())
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var ratingReq RatingRequest
+		if err := json.NewDecoder(r.Body).Decode(&ratingReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding rating request", "error", err)
+			return
+		}
+		if ratingReq.Score == nil || *ratingReq.Score < 0 || *ratingReq.Score > 10 {
+			http.Error(w, "Invalid rating score", http.StatusBadRequest)
+			return
+		}
+
+		var rating RatingResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			// The foreign key keeps the rating consistent with a concurrent
+			// purge, so the movie row need not be locked.
+			if err := ensureMovieExists(r.Context(), tx, movieID); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(r.Context(), `INSERT INTO movie_ratings (movie_id, username, score) VALUES ($1, $2, $3)
+				ON CONFLICT (movie_id, username) DO UPDATE SET score = EXCLUDED.score, updated_at = now()`,
+				movieID, username, *ratingReq.Score)
+			if err != nil {
+				return fmt.Errorf("saving rating: %w", err)
+			}
+			rating, err = fetchRating(r.Context(), tx, movieID, username)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error rating movie:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, rating); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding rating response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to rate movie")
+	}
+}
+
+// getMovieRatingHandler returns the authenticated user's rating of a movie.
+func getMovieRatingHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rating, err := fetchRating(r.Context(), db, movieID, helpers2.GetUsernameFromContext(r.Context()))
+		if err != nil {
+			writeError(w, r, err, "Error getting rating from database:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, rating); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding rating response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get movie rating")
+	}
+}
+
+// deleteMovieRatingHandler withdraws the authenticated user's rating of a movie.
+func deleteMovieRatingHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.ExecContext(r.Context(), "DELETE FROM movie_ratings WHERE movie_id=$1 AND username=$2",
+			movieID, helpers2.GetUsernameFromContext(r.Context()))
+		if err == nil {
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				err = sql.ErrNoRows
+			}
+		}
+		if err != nil {
+			writeError(w, r, err, "Error deleting rating:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete movie rating")
+	}
+}
+
+func fetchRating(ctx context.Context, q queryer, movieID int, username string) (RatingResponse, error) {
+	var rating RatingResponse
+	err := q.QueryRowContext(ctx, `SELECT movie_id, username, score::float8, updated_at FROM movie_ratings
+		WHERE movie_id = $1 AND username = $2`, movieID, username).
+		Scan(&rating.MovieID, &rating.Username, &rating.Score, &rating.UpdatedAt)
+	return rating, err
+}
@@ -0,0 +1,466 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/validation"
+	"net/http"
+	"strconv"
+)
+
+// ReviewRequest is the body of review create and update requests. Rating,
+// when present, is stored as the author's rating of the movie.
+type ReviewRequest struct {
+	MovieID int      `json:"movie_id,omitempty"`
+	Title   string   `json:"title"`
+	Body    string   `json:"body"`
+	Spoiler bool     `json:"spoiler"`
+	Rating  *float64 `json:"rating,omitempty"`
+}
+
+type ModerationRequest struct {
+	Reason string `json:"reason"`
+}
+
+func createReviewHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := helpers2.GetUsernameFromContext(r.Context())
+		var reviewReq ReviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&reviewReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding review request on creating", "error", err)
+			return
+		}
+		if reviewReq.MovieID <= 0 || !validReviewRequest(reviewReq) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var review ReviewResponse
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			// The foreign key keeps the review consistent with a concurrent
+			// purge, so the movie row need not be locked.
+			if err := ensureMovieExists(r.Context(), tx, reviewReq.MovieID); err != nil {
+				return err
+			}
+			var exists bool
+			err := tx.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM reviews WHERE movie_id = $1 AND username = $2)",
+				reviewReq.MovieID, username).Scan(&exists)
+			if err != nil {
+				return fmt.Errorf("checking existing review: %w", err)
+			}
+			if exists {
+				return newStatusError(http.StatusConflict, "you have already reviewed this movie")
+			}
+			var reviewID int
+			err = tx.QueryRowContext(r.Context(), `INSERT INTO reviews (movie_id, username, title, body, spoiler)
+				VALUES ($1, $2, $3, $4, $5) RETURNING review_id`,
+				reviewReq.MovieID, username, reviewReq.Title, reviewReq.Body, reviewReq.Spoiler).Scan(&reviewID)
+			if err != nil {
+				return fmt.Errorf("inserting review: %w", err)
+			}
+			if err := saveReviewRating(r.Context(), tx, reviewReq.MovieID, username, reviewReq.Rating); err != nil {
+				return err
+			}
+			review, err = fetchReview(r.Context(), tx, reviewID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error creating review:")
+			return
+		}
+
+		w.Header().Set("Location", "/reviews/get?id="+strconv.Itoa(review.ID))
+		if err := writeJSON(w, http.StatusCreated, review); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding created review", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to create review")
+	}
+}
+
+// updateReviewHandler replaces the title, body, spoiler flag and rating of
+// a review. Only the author may edit a review.
+func updateReviewHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := helpers2.GetUsernameFromContext(r.Context())
+		reviewID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var reviewReq ReviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&reviewReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding review request on updating", "error", err)
+			return
+		}
+		if !validReviewRequest(reviewReq) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var review ReviewResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			movieID, author, err := lockReview(r.Context(), tx, reviewID)
+			if err != nil {
+				return err
+			}
+			if author != username {
+				return newStatusError(http.StatusForbidden, "Forbidden")
+			}
+			_, err = tx.ExecContext(r.Context(), `UPDATE reviews SET title=$1, body=$2, spoiler=$3, updated_at=now()
+				WHERE review_id=$4`, reviewReq.Title, reviewReq.Body, reviewReq.Spoiler, reviewID)
+			if err != nil {
+				return fmt.Errorf("updating review: %w", err)
+			}
+			if err := saveReviewRating(r.Context(), tx, movieID, username, reviewReq.Rating); err != nil {
+				return err
+			}
+			review, err = fetchReview(r.Context(), tx, reviewID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error updating review:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, review); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding updated review", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to update review")
+	}
+}
+
+// deleteReviewHandler deletes a review. Authors may delete their own
+// reviews; admins may delete any review but must give a moderation reason.
+func deleteReviewHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := helpers2.GetUsernameFromContext(r.Context())
+		isAdmin := helpers2.GetRoleFromContext(r.Context()) == "admin"
+		reviewID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reason := r.URL.Query().Get("reason")
+
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			_, author, err := lockReview(r.Context(), tx, reviewID)
+			if err != nil {
+				return err
+			}
+			if author != username {
+				if !isAdmin {
+					return newStatusError(http.StatusForbidden, "Forbidden")
+				}
+				if !validModerationReason(reason) {
+					return newStatusError(http.StatusBadRequest, "a moderation reason is required")
+				}
+				if err := recordModeration(r.Context(), tx, reviewID, "delete", reason, username); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.ExecContext(r.Context(), "DELETE FROM reviews WHERE review_id=$1", reviewID); err != nil {
+				return fmt.Errorf("deleting review: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting review:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete review")
+	}
+}
+
+// hideReviewHandler hides a review from everyone but admins and its author,
+// recording the moderation reason.
+func hideReviewHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		reviewID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var moderationReq ModerationRequest
+		if err := json.NewDecoder(r.Body).Decode(&moderationReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding moderation request", "error", err)
+			return
+		}
+		if !validModerationReason(moderationReq.Reason) {
+			http.Error(w, "a moderation reason is required", http.StatusBadRequest)
+			return
+		}
+
+		review, err := setReviewHidden(r, db, reviewID, true, moderationReq.Reason)
+		if err != nil {
+			writeError(w, r, err, "Error hiding review:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, review); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding hidden review", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to hide review")
+	}
+}
+
+func unhideReviewHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		reviewID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		review, err := setReviewHidden(r, db, reviewID, false, "")
+		if err != nil {
+			writeError(w, r, err, "Error unhiding review:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, review); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding unhidden review", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to unhide review")
+	}
+}
+
+func getReviewHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reviewID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		review, err := fetchReview(r.Context(), db, reviewID)
+		if err == nil && !canSeeReview(r, review) {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			writeError(w, r, err, "Error getting review from database:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, redactReview(r, review)); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding review response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get review")
+	}
+}
+
+// getMovieReviewsHandler lists the reviews of a movie, newest first.
+func getMovieReviewsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var filter sqlFilter
+		filter.where("rv.movie_id = " + filter.arg(movieID))
+
+		reviewPage, err := queryReviewPage(r, db, filter)
+		if err != nil {
+			writeError(w, r, err, "Error getting movie reviews from database:")
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, reviewPage); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding reviews response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get movie reviews")
+	}
+}
+
+// getUserReviewsHandler lists the reviews written by a user, newest first.
+// Without a username the authenticated user's reviews are listed.
+func getUserReviewsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := r.URL.Query().Get("username")
+		if username == "" {
+			username = helpers2.GetUsernameFromContext(r.Context())
+		}
+		var filter sqlFilter
+		filter.where("rv.username = " + filter.arg(username))
+
+		reviewPage, err := queryReviewPage(r, db, filter)
+		if err != nil {
+			writeError(w, r, err, "Error getting user reviews from database:")
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, reviewPage); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding reviews response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get user reviews")
+	}
+}
+
+func validReviewRequest(reviewReq ReviewRequest) bool {
+	if reviewReq.Rating != nil && (*reviewReq.Rating < 0 || *reviewReq.Rating > 10) {
+		return false
+	}
+	return validation.Name(reviewReq.Title) && validation.ReviewBody(reviewReq.Body)
+}
+
+func validModerationReason(reason string) bool {
+	return reason != "" && validation.Description(reason)
+}
+
+// saveReviewRating stores the rating given with a review as the author's
+// rating of the movie.
+func saveReviewRating(ctx context.Context, tx *sql.Tx, movieID int, username string, score *float64) error {
+	if score == nil {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO movie_ratings (movie_id, username, score) VALUES ($1, $2, $3)
+		ON CONFLICT (movie_id, username) DO UPDATE SET score = EXCLUDED.score, updated_at = now()`,
+		movieID, username, *score)
+	if err != nil {
+		return fmt.Errorf("saving review rating: %w", err)
+	}
+	return nil
+}
+
+func setReviewHidden(r *http.Request, db *sql.DB, reviewID int, hidden bool, reason string) (ReviewResponse, error) {
+	var review ReviewResponse
+	err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+		if _, _, err := lockReview(r.Context(), tx, reviewID); err != nil {
+			return err
+		}
+		action := "unhide"
+		if hidden {
+			action = "hide"
+		}
+		if err := recordModeration(r.Context(), tx, reviewID, action, reason, helpers2.GetUsernameFromContext(r.Context())); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(r.Context(), "UPDATE reviews SET hidden=$1, moderation_reason=NULLIF($2, '') WHERE review_id=$3",
+			hidden, reason, reviewID)
+		if err != nil {
+			return fmt.Errorf("updating review visibility: %w", err)
+		}
+		review, err = fetchReview(r.Context(), tx, reviewID)
+		return err
+	})
+	return review, err
+}
+
+// recordModeration keeps a record of admin actions on reviews; the record
+// outlives the review when the action is a deletion.
+func recordModeration(ctx context.Context, tx *sql.Tx, reviewID int, action, reason, moderator string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO review_moderations (review_id, movie_id, author, action, reason, moderator)
+		SELECT review_id, movie_id, username, $2, NULLIF($3, ''), $4 FROM reviews WHERE review_id = $1`,
+		reviewID, action, reason, moderator)
+	if err != nil {
+		return fmt.Errorf("recording review moderation: %w", err)
+	}
+	return nil
+}
+
+func lockReview(ctx context.Context, tx *sql.Tx, reviewID int) (movieID int, author string, err error) {
+	err = tx.QueryRowContext(ctx, "SELECT movie_id, username FROM reviews WHERE review_id = $1 FOR UPDATE", reviewID).
+		Scan(&movieID, &author)
+	return movieID, author, err
+}
+
+// reviewColumns is the select list, over reviews aliased as rv, scanned by
+// scanReview. The rating is the author's current rating of the movie.
+const reviewColumns = `rv.review_id, rv.movie_id, rv.username, rv.title, rv.body, rv.spoiler,
+	(SELECT mr.score::float8 FROM movie_ratings mr WHERE mr.movie_id = rv.movie_id AND mr.username = rv.username),
+	rv.hidden, COALESCE(rv.moderation_reason, ''), rv.created_at, rv.updated_at`
+
+func scanReview(row rowScanner) (ReviewResponse, error) {
+	var review ReviewResponse
+	var rating sql.NullFloat64
+	err := row.Scan(&review.ID, &review.MovieID, &review.Username, &review.Title, &review.Body, &review.Spoiler,
+		&rating, &review.Hidden, &review.ModerationReason, &review.CreatedAt, &review.UpdatedAt)
+	if rating.Valid {
+		review.Rating = &rating.Float64
+	}
+	return review, err
+}
+
+// fetchReview reads a review. Reviews of trashed movies are hidden, as they
+// are from the listings.
+func fetchReview(ctx context.Context, q queryer, reviewID int) (ReviewResponse, error) {
+	return scanReview(q.QueryRowContext(ctx, `SELECT `+reviewColumns+` FROM reviews rv WHERE rv.review_id = $1
+		AND EXISTS(SELECT 1 FROM movies m WHERE m.movie_id = rv.movie_id AND m.deleted_at IS NULL)`, reviewID))
+}
+
+// queryReviewPage returns the page of reviews matching filter that the
+// requester may see.
+func queryReviewPage(r *http.Request, db *sql.DB, filter sqlFilter) (ReviewPageResponse, error) {
+	page, pageSize, err := pageFromQuery(r)
+	if err != nil {
+		return ReviewPageResponse{}, newStatusError(http.StatusBadRequest, "%v", err)
+	}
+	filter.where("EXISTS(SELECT 1 FROM movies m WHERE m.movie_id = rv.movie_id AND m.deleted_at IS NULL)")
+	if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+		filter.where("(NOT rv.hidden OR rv.username = " + filter.arg(helpers2.GetUsernameFromContext(r.Context())) + ")")
+	}
+
+	reviewPage := ReviewPageResponse{Reviews: []ReviewResponse{}, Page: page, PageSize: pageSize}
+	err = db.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM reviews rv`+filter.clause(), filter.args...).
+		Scan(&reviewPage.Total)
+	if err != nil {
+		return reviewPage, fmt.Errorf("counting reviews: %w", err)
+	}
+
+	limit, offset := filter.arg(pageSize), filter.arg((page-1)*pageSize)
+	rows, err := db.QueryContext(r.Context(), `SELECT `+reviewColumns+` FROM reviews rv`+filter.clause()+`
+		ORDER BY rv.created_at DESC, rv.review_id DESC
+		LIMIT `+limit+` OFFSET `+offset, filter.args...)
+	if err != nil {
+		return reviewPage, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return reviewPage, err
+		}
+		reviewPage.Reviews = append(reviewPage.Reviews, redactReview(r, review))
+	}
+	return reviewPage, rows.Err()
+}
+
+func canSeeReview(r *http.Request, review ReviewResponse) bool {
+	return !review.Hidden || helpers2.GetRoleFromContext(r.Context()) == "admin" ||
+		review.Username == helpers2.GetUsernameFromContext(r.Context())
+}
+
+// redactReview drops moderation details for requesters other than admins
+// and the author.
+func redactReview(r *http.Request, review ReviewResponse) ReviewResponse {
+	if helpers2.GetRoleFromContext(r.Context()) != "admin" && review.Username != helpers2.GetUsernameFromContext(r.Context()) {
+		review.Hidden = false
+		review.ModerationReason = ""
+	}
+	return review
+}
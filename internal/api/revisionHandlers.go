@@ -0,0 +1,424 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log/slog"
+	"movieLibrary/internal/config"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Entity types revisions are recorded for.
+const (
+	movieEntity = "movie"
+	actorEntity = "actor"
+)
+
+// revisionTables maps each entity type to its table and key column.
+var revisionTables = map[string]struct{ table, key string }{
+	movieEntity: {"movies", "movie_id"},
+	actorEntity: {"actors", "actor_id"},
+}
+
+// movieSnapshot is the state of a movie a revision records: its patchable
+// document with the full credits in place of bare actor references.
+type movieSnapshot struct {
+	movieDocument
+	Actors []CastMemberRequest `json:"actors"`
+}
+
+const revisionColumns = `revision_id, entity_type, entity_id, version, action, snapshot, changes, changed_by, changed_at`
+
+// getRevisionsHandler lists the revisions of a movie or actor, newest first.
+func getRevisionsHandler(db *sql.DB, entityType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		entityID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		revisions, err := queryRevisions(r.Context(), db, `SELECT `+revisionColumns+` FROM revisions
+			WHERE entity_type = $1 AND entity_id = $2 ORDER BY revision_id DESC`, entityType, entityID)
+		if err == nil && len(revisions) == 0 {
+			err = ensureEntityExists(r.Context(), db, entityType, entityID)
+		}
+		if err != nil {
+			writeError(w, r, err, "Error getting revisions from database:")
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, revisions); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding revisions response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get revisions", "entity_type", entityType)
+	}
+}
+
+// getRevisionAsOfHandler returns the revision of a movie or actor that was
+// current at the time given by the at parameter.
+func getRevisionAsOfHandler(db *sql.DB, entityType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		entityID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		at, err := time.Parse(time.RFC3339, r.URL.Query().Get("at"))
+		if err != nil {
+			http.Error(w, "at must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+
+		revisions, err := queryRevisions(r.Context(), db, `SELECT `+revisionColumns+` FROM revisions
+			WHERE entity_type = $1 AND entity_id = $2 AND changed_at <= $3
+			ORDER BY revision_id DESC LIMIT 1`, entityType, entityID, at)
+		if err == nil && (len(revisions) == 0 || revisions[0].Action == "delete" || revisions[0].Action == "merge") {
+			err = newStatusError(http.StatusNotFound, "%s %d did not exist at %s", entityType, entityID, at.Format(time.RFC3339))
+		}
+		if err != nil {
+			writeError(w, r, err, "Error getting revision from database:")
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, revisions[0]); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding revision response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get revision as of a time", "entity_type", entityType)
+	}
+}
+
+// revertMovieHandler restores the fields and cast a movie had at an earlier
+// revision. The revert is itself recorded as a new revision.
+func revertMovieHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		revisionID, err := idFromQuery(r, "revision")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var movie MovieResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			version, err := lockMovie(r.Context(), tx, movieID)
+			if err != nil {
+				return err
+			}
+			if err := checkIfMatch(r, cfg.RequireIfMatch, version); err != nil {
+				return err
+			}
+			var snapshot movieSnapshot
+			if err := loadRevisionSnapshot(r.Context(), tx, movieEntity, movieID, revisionID, &snapshot); err != nil {
+				return err
+			}
+			if err := snapshot.validate(); err != nil {
+				return err
+			}
+			if err := storeMovieDocument(r.Context(), tx, movieID, snapshot.movieDocument); err != nil {
+				return err
+			}
+			if err := replaceMovieCast(r.Context(), tx, movieID, snapshot.Actors, false); err != nil {
+				return err
+			}
+			if err := recordRevision(r.Context(), tx, movieEntity, movieID, "revert"); err != nil {
+				return err
+			}
+			movie, err = fetchMovie(r.Context(), tx, movieID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error reverting movie:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(movie.Version))
+		if err := writeJSON(w, http.StatusOK, movie); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding reverted movie", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to revert movie")
+	}
+}
+
+// revertActorHandler restores the details an actor had at an earlier
+// revision. The revert is itself recorded as a new revision.
+func revertActorHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		actorID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		revisionID, err := idFromQuery(r, "revision")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var actor ActorResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			version, err := lockActor(r.Context(), tx, actorID)
+			if err != nil {
+				return err
+			}
+			if err := checkIfMatch(r, cfg.RequireIfMatch, version); err != nil {
+				return err
+			}
+			var snapshot actorDocument
+			if err := loadRevisionSnapshot(r.Context(), tx, actorEntity, actorID, revisionID, &snapshot); err != nil {
+				return err
+			}
+			if err := snapshot.validate(); err != nil {
+				return err
+			}
+			if err := storeActorDocument(r.Context(), tx, actorID, snapshot); err != nil {
+				return err
+			}
+			if err := recordRevision(r.Context(), tx, actorEntity, actorID, "revert"); err != nil {
+				return err
+			}
+			actor, err = fetchActor(r.Context(), tx, actorID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error reverting actor:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(actor.Version))
+		if err := writeJSON(w, http.StatusOK, actor); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding reverted actor", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to revert actor")
+	}
+}
+
+// recordRevision stores the current state of an entity as a new revision,
+// together with the fields that changed since the previous one and the user
+// who changed them. Updates that leave the recorded state unchanged, such as
+// a new translation, are not recorded.
+func recordRevision(ctx context.Context, tx *sql.Tx, entityType string, entityID int, action string) error {
+	var snapshot interface{}
+	var err error
+	switch entityType {
+	case movieEntity:
+		snapshot, err = loadMovieSnapshot(ctx, tx, entityID)
+	case actorEntity:
+		snapshot, err = loadActorDocument(ctx, tx, entityID)
+	default:
+		return fmt.Errorf("recording revision: unknown entity type %q", entityType)
+	}
+	if err != nil {
+		return err
+	}
+	current, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("encoding revision snapshot: %w", err)
+	}
+
+	var previous []byte
+	err = tx.QueryRowContext(ctx, `SELECT snapshot FROM revisions WHERE entity_type = $1 AND entity_id = $2
+		ORDER BY revision_id DESC LIMIT 1`, entityType, entityID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("reading previous revision: %w", err)
+	}
+	changes, err := snapshotChanges(previous, current)
+	if err != nil {
+		return err
+	}
+	if action == "update" && len(changes) == 0 {
+		return nil
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("encoding revision changes: %w", err)
+	}
+
+	entity := revisionTables[entityType]
+	_, err = tx.ExecContext(ctx, `INSERT INTO revisions (entity_type, entity_id, version, action, snapshot, changes, changed_by)
+		SELECT $1, $2, version, $3, $4, $5, $6 FROM `+entity.table+` WHERE `+entity.key+` = $2`,
+		entityType, entityID, action, current, changesJSON, helpers2.GetUsernameFromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("inserting revision: %w", err)
+	}
+	return nil
+}
+
+// recordMovieRevisions records an update of each of the movies, typically
+// after a change to one of their cast members.
+func recordMovieRevisions(ctx context.Context, tx *sql.Tx, movieIDs []int64) error {
+	for _, movieID := range movieIDs {
+		if err := recordRevision(ctx, tx, movieEntity, int(movieID), "update"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotChanges compares two snapshots field by field. A nil previous
+// snapshot stands for an entity that had no revision yet.
+func snapshotChanges(previous, current []byte) (map[string]RevisionChangeResponse, error) {
+	before := map[string]json.RawMessage{}
+	if previous != nil {
+		if err := json.Unmarshal(previous, &before); err != nil {
+			return nil, fmt.Errorf("decoding previous revision: %w", err)
+		}
+	}
+	after := map[string]json.RawMessage{}
+	if err := json.Unmarshal(current, &after); err != nil {
+		return nil, fmt.Errorf("decoding revision snapshot: %w", err)
+	}
+
+	fields := make([]string, 0, len(after))
+	for field := range after {
+		fields = append(fields, field)
+	}
+	for field := range before {
+		if _, ok := after[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := map[string]RevisionChangeResponse{}
+	for _, field := range fields {
+		// Stored snapshots come back from jsonb reformatted, so values are
+		// compared decoded rather than byte by byte.
+		var from, to interface{}
+		if before[field] != nil {
+			if err := json.Unmarshal(before[field], &from); err != nil {
+				return nil, fmt.Errorf("decoding previous %s: %w", field, err)
+			}
+		}
+		if after[field] != nil {
+			if err := json.Unmarshal(after[field], &to); err != nil {
+				return nil, fmt.Errorf("decoding %s: %w", field, err)
+			}
+		}
+		if !reflect.DeepEqual(from, to) {
+			changes[field] = RevisionChangeResponse{From: before[field], To: after[field]}
+		}
+	}
+	return changes, nil
+}
+
+// loadMovieSnapshot reads the state of a movie recorded in its revisions.
+func loadMovieSnapshot(ctx context.Context, tx *sql.Tx, movieID int) (movieSnapshot, error) {
+	doc, _, err := loadMovieDocument(ctx, tx, movieID)
+	if err != nil {
+		return movieSnapshot{}, err
+	}
+	snapshot := movieSnapshot{movieDocument: doc, Actors: []CastMemberRequest{}}
+
+	rows, err := tx.QueryContext(ctx, `SELECT a.actor_id, a.name, ma.characters, COALESCE(ma.billing_order, 0),
+			COALESCE(ma.credit_type, '')
+		FROM actors a
+		JOIN movies_actors ma ON a.actor_id = ma.actor_id
+		WHERE ma.movie_id = $1 AND a.deleted_at IS NULL
+		ORDER BY ma.billing_order NULLS LAST, a.name`, movieID)
+	if err != nil {
+		return snapshot, fmt.Errorf("reading movie credits: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member CastMemberRequest
+		err := rows.Scan(&member.ActorID, &member.Name, pq.Array(&member.Characters), &member.BillingOrder, &member.CreditType)
+		if err != nil {
+			return snapshot, fmt.Errorf("scanning movie credits: %w", err)
+		}
+		snapshot.Actors = append(snapshot.Actors, member)
+	}
+	return snapshot, rows.Err()
+}
+
+// loadRevisionSnapshot decodes the snapshot of a revision of the given entity
+// into dst. Revisions of other entities are reported as not found.
+func loadRevisionSnapshot(ctx context.Context, tx *sql.Tx, entityType string, entityID, revisionID int, dst interface{}) error {
+	var snapshot []byte
+	err := tx.QueryRowContext(ctx, `SELECT snapshot FROM revisions
+		WHERE revision_id = $1 AND entity_type = $2 AND entity_id = $3`, revisionID, entityType, entityID).Scan(&snapshot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return newStatusError(http.StatusNotFound, "%s %d has no revision %d", entityType, entityID, revisionID)
+	}
+	if err != nil {
+		return fmt.Errorf("reading revision: %w", err)
+	}
+	if err := json.Unmarshal(snapshot, dst); err != nil {
+		return fmt.Errorf("decoding revision snapshot: %w", err)
+	}
+	return nil
+}
+
+// ensureEntityExists reports sql.ErrNoRows for entities that were never
+// created. Entities in the trash exist.
+func ensureEntityExists(ctx context.Context, q queryer, entityType string, entityID int) error {
+	entity := revisionTables[entityType]
+	var exists bool
+	err := q.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM `+entity.table+` WHERE `+entity.key+` = $1)`, entityID).
+		Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func queryRevisions(ctx context.Context, q queryer, query string, args ...interface{}) ([]RevisionResponse, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []RevisionResponse{}
+	for rows.Next() {
+		var revision RevisionResponse
+		var snapshot, changes []byte
+		err := rows.Scan(&revision.ID, &revision.EntityType, &revision.EntityID, &revision.Version, &revision.Action,
+			&snapshot, &changes, &revision.ChangedBy, &revision.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		revision.Snapshot = snapshot
+		if err := json.Unmarshal(changes, &revision.Changes); err != nil {
+			return nil, fmt.Errorf("unmarshalling revision changes JSON: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
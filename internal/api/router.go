@@ -2,22 +2,135 @@ package api
 
 import (
 	"database/sql"
+	"movieLibrary/internal/config"
+	"movieLibrary/internal/pkg/storage"
 	"net/http"
 )
 
-func StartApi(db *sql.DB) http.Handler {
+func StartApi(db *sql.DB, cfg config.Config, media storage.Store) http.Handler {
 	router := http.NewServeMux()
 
 	router.HandleFunc("/actors/create", BasicAuthMiddleware(db, createActorHandler(db)))
-	router.HandleFunc("/actors/update", BasicAuthMiddleware(db, updateActorHandler(db)))
-	router.HandleFunc("/actors/delete", BasicAuthMiddleware(db, deleteActorHandler(db)))
+	router.HandleFunc("/actors/bulk", BasicAuthMiddleware(db, bulkCreateActorsHandler(db)))
+	router.HandleFunc("/actors/update", BasicAuthMiddleware(db, updateActorHandler(db, cfg)))
+	router.HandleFunc("PATCH /actors/update", BasicAuthMiddleware(db, patchActorHandler(db, cfg)))
+	router.HandleFunc("/actors/delete", BasicAuthMiddleware(db, deleteActorHandler(db, cfg)))
+	router.HandleFunc("/actors/get", BasicAuthMiddleware(db, getActorHandler(db)))
 	router.HandleFunc("/actors", BasicAuthMiddleware(db, getActorsHandler(db)))
+	router.HandleFunc("GET /actors/duplicates", BasicAuthMiddleware(db, getDuplicateActorsHandler(db)))
+	router.HandleFunc("POST /actors/merge", BasicAuthMiddleware(db, mergeActorsHandler(db, cfg, media)))
+	router.HandleFunc("GET /actors/merges", BasicAuthMiddleware(db, getActorMergesHandler(db)))
+	router.HandleFunc("GET /actors/revisions", BasicAuthMiddleware(db, getRevisionsHandler(db, actorEntity)))
+	router.HandleFunc("GET /actors/asof", BasicAuthMiddleware(db, getRevisionAsOfHandler(db, actorEntity)))
+	router.HandleFunc("POST /actors/revert", BasicAuthMiddleware(db, revertActorHandler(db, cfg)))
+	router.HandleFunc("GET /actors/aliases", BasicAuthMiddleware(db, getActorAliasesHandler(db)))
+	router.HandleFunc("POST /actors/aliases", BasicAuthMiddleware(db, addActorAliasHandler(db, cfg)))
+	router.HandleFunc("DELETE /actors/aliases", BasicAuthMiddleware(db, removeActorAliasHandler(db, cfg)))
+	router.HandleFunc("POST /actors/images", BasicAuthMiddleware(db, uploadActorImageHandler(db, cfg, media)))
+	router.HandleFunc("DELETE /actors/images", BasicAuthMiddleware(db, deleteActorImageHandler(db, cfg, media)))
+	router.HandleFunc("GET /actors/translations", BasicAuthMiddleware(db, getActorTranslationsHandler(db)))
+	router.HandleFunc("PUT /actors/translations", BasicAuthMiddleware(db, putActorTranslationHandler(db, cfg)))
+	router.HandleFunc("DELETE /actors/translations", BasicAuthMiddleware(db, deleteActorTranslationHandler(db, cfg)))
 
 	router.HandleFunc("/movies/create", BasicAuthMiddleware(db, createMovieHandler(db)))
-	router.HandleFunc("/movies/update", BasicAuthMiddleware(db, updateMovieHandler(db)))
-	router.HandleFunc("/movies/delete", BasicAuthMiddleware(db, deleteMovieHandler(db)))
+	router.HandleFunc("/movies/bulk", BasicAuthMiddleware(db, bulkCreateMoviesHandler(db)))
+	router.HandleFunc("/movies/update", BasicAuthMiddleware(db, updateMovieHandler(db, cfg)))
+	router.HandleFunc("PATCH /movies/update", BasicAuthMiddleware(db, patchMovieHandler(db, cfg)))
+	router.HandleFunc("/movies/delete", BasicAuthMiddleware(db, deleteMovieHandler(db, cfg)))
+	router.HandleFunc("/movies/cast/add", BasicAuthMiddleware(db, addMovieActorsHandler(db, cfg)))
+	router.HandleFunc("/movies/cast/remove", BasicAuthMiddleware(db, removeMovieActorHandler(db, cfg)))
+	router.HandleFunc("/movies/cast/order", BasicAuthMiddleware(db, reorderMovieActorsHandler(db, cfg)))
+	router.HandleFunc("/movies/crew/add", BasicAuthMiddleware(db, addMovieCrewHandler(db, cfg)))
+	router.HandleFunc("/movies/crew/remove", BasicAuthMiddleware(db, removeMovieCrewHandler(db, cfg)))
+	router.HandleFunc("POST /movies/images", BasicAuthMiddleware(db, uploadMovieImageHandler(db, cfg, media)))
+	router.HandleFunc("DELETE /movies/images", BasicAuthMiddleware(db, deleteMovieImageHandler(db, cfg, media)))
+	router.HandleFunc("GET /movies/translations", BasicAuthMiddleware(db, getMovieTranslationsHandler(db)))
+	router.HandleFunc("PUT /movies/translations", BasicAuthMiddleware(db, putMovieTranslationHandler(db, cfg)))
+	router.HandleFunc("DELETE /movies/translations", BasicAuthMiddleware(db, deleteMovieTranslationHandler(db, cfg)))
+	router.HandleFunc("GET /movies/revisions", BasicAuthMiddleware(db, getRevisionsHandler(db, movieEntity)))
+	router.HandleFunc("GET /movies/asof", BasicAuthMiddleware(db, getRevisionAsOfHandler(db, movieEntity)))
+	router.HandleFunc("POST /movies/revert", BasicAuthMiddleware(db, revertMovieHandler(db, cfg)))
+	router.HandleFunc("PUT /movies/rating", BasicAuthMiddleware(db, rateMovieHandler(db)))
+	router.HandleFunc("GET /movies/rating", BasicAuthMiddleware(db, getMovieRatingHandler(db)))
+	router.HandleFunc("DELETE /movies/rating", BasicAuthMiddleware(db, deleteMovieRatingHandler(db)))
+	router.HandleFunc("/movies/relations/add", BasicAuthMiddleware(db, addMovieRelationHandler(db, cfg)))
+	router.HandleFunc("/movies/relations/remove", BasicAuthMiddleware(db, removeMovieRelationHandler(db, cfg)))
+	router.HandleFunc("/movies/by-external-id", BasicAuthMiddleware(db, getMovieByExternalIDHandler(db)))
+	router.HandleFunc("/movies/get", BasicAuthMiddleware(db, getMovieHandler(db)))
 	router.HandleFunc("/movies", BasicAuthMiddleware(db, getMoviesHandler(db)))
 	router.HandleFunc("/movies/search", BasicAuthMiddleware(db, searchMoviesHandler(db)))
 
-	return router
+	router.HandleFunc("/movies/reviews", BasicAuthMiddleware(db, getMovieReviewsHandler(db)))
+
+	router.HandleFunc("/reviews/create", BasicAuthMiddleware(db, createReviewHandler(db)))
+	router.HandleFunc("/reviews/update", BasicAuthMiddleware(db, updateReviewHandler(db)))
+	router.HandleFunc("/reviews/delete", BasicAuthMiddleware(db, deleteReviewHandler(db)))
+	router.HandleFunc("/reviews/hide", BasicAuthMiddleware(db, hideReviewHandler(db)))
+	router.HandleFunc("/reviews/unhide", BasicAuthMiddleware(db, unhideReviewHandler(db)))
+	router.HandleFunc("/reviews/get", BasicAuthMiddleware(db, getReviewHandler(db)))
+	router.HandleFunc("/reviews", BasicAuthMiddleware(db, getUserReviewsHandler(db)))
+
+	router.HandleFunc("/watchlist/add", BasicAuthMiddleware(db, addToWatchlistHandler(db)))
+	router.HandleFunc("/watchlist/remove", BasicAuthMiddleware(db, removeFromWatchlistHandler(db)))
+	router.HandleFunc("/watchlist", BasicAuthMiddleware(db, getWatchlistHandler(db)))
+	router.HandleFunc("/watched/add", BasicAuthMiddleware(db, markWatchedHandler(db)))
+	router.HandleFunc("/watched/remove", BasicAuthMiddleware(db, unmarkWatchedHandler(db)))
+	router.HandleFunc("/watched", BasicAuthMiddleware(db, getWatchedHandler(db)))
+
+	router.HandleFunc("/collections/create", BasicAuthMiddleware(db, createCollectionHandler(db)))
+	router.HandleFunc("/collections/update", BasicAuthMiddleware(db, updateCollectionHandler(db)))
+	router.HandleFunc("/collections/delete", BasicAuthMiddleware(db, deleteCollectionHandler(db)))
+	router.HandleFunc("/collections/entries/add", BasicAuthMiddleware(db, addCollectionEntryHandler(db)))
+	router.HandleFunc("/collections/entries/remove", BasicAuthMiddleware(db, removeCollectionEntryHandler(db)))
+	router.HandleFunc("/collections/entries/order", BasicAuthMiddleware(db, reorderCollectionHandler(db)))
+	router.HandleFunc("/collections/get", BasicAuthMiddleware(db, getCollectionHandler(db)))
+	router.HandleFunc("/collections", BasicAuthMiddleware(db, getCollectionsHandler(db)))
+
+	router.HandleFunc("/franchises/create", BasicAuthMiddleware(db, createFranchiseHandler(db)))
+	router.HandleFunc("/franchises/update", BasicAuthMiddleware(db, updateFranchiseHandler(db)))
+	router.HandleFunc("/franchises/delete", BasicAuthMiddleware(db, deleteFranchiseHandler(db)))
+	router.HandleFunc("/franchises/movies/add", BasicAuthMiddleware(db, addFranchiseMovieHandler(db)))
+	router.HandleFunc("/franchises/movies/remove", BasicAuthMiddleware(db, removeFranchiseMovieHandler(db)))
+	router.HandleFunc("/franchises/movies/order", BasicAuthMiddleware(db, reorderFranchiseHandler(db)))
+	router.HandleFunc("/franchises", BasicAuthMiddleware(db, getFranchisesHandler(db)))
+
+	router.HandleFunc("/series/create", BasicAuthMiddleware(db, createSeriesHandler(db)))
+	router.HandleFunc("/series/update", BasicAuthMiddleware(db, updateSeriesHandler(db)))
+	router.HandleFunc("/series/delete", BasicAuthMiddleware(db, deleteSeriesHandler(db)))
+	router.HandleFunc("/series/get", BasicAuthMiddleware(db, getSeriesHandler(db)))
+	router.HandleFunc("/series/search", BasicAuthMiddleware(db, searchSeriesHandler(db)))
+	router.HandleFunc("/series", BasicAuthMiddleware(db, getSeriesListHandler(db)))
+	router.HandleFunc("/seasons/create", BasicAuthMiddleware(db, createSeasonHandler(db)))
+	router.HandleFunc("/seasons/update", BasicAuthMiddleware(db, updateSeasonHandler(db)))
+	router.HandleFunc("/seasons/delete", BasicAuthMiddleware(db, deleteSeasonHandler(db)))
+	router.HandleFunc("/seasons/get", BasicAuthMiddleware(db, getSeasonHandler(db)))
+	router.HandleFunc("/episodes/create", BasicAuthMiddleware(db, createEpisodeHandler(db)))
+	router.HandleFunc("/episodes/update", BasicAuthMiddleware(db, updateEpisodeHandler(db)))
+	router.HandleFunc("/episodes/delete", BasicAuthMiddleware(db, deleteEpisodeHandler(db)))
+	router.HandleFunc("/episodes/get", BasicAuthMiddleware(db, getEpisodeHandler(db)))
+	router.HandleFunc("/episodes", BasicAuthMiddleware(db, getEpisodesHandler(db)))
+
+	router.HandleFunc("/people/create", BasicAuthMiddleware(db, createPersonHandler(db)))
+	router.HandleFunc("/people/update", BasicAuthMiddleware(db, updatePersonHandler(db)))
+	router.HandleFunc("/people/delete", BasicAuthMiddleware(db, deletePersonHandler(db)))
+	router.HandleFunc("/people/get", BasicAuthMiddleware(db, getPersonHandler(db)))
+	router.HandleFunc("/people", BasicAuthMiddleware(db, getPeopleHandler(db)))
+
+	router.HandleFunc("/genres/create", BasicAuthMiddleware(db, createGenreHandler(db)))
+	router.HandleFunc("/genres/update", BasicAuthMiddleware(db, updateGenreHandler(db)))
+	router.HandleFunc("/genres/delete", BasicAuthMiddleware(db, deleteGenreHandler(db)))
+	router.HandleFunc("/genres", BasicAuthMiddleware(db, getGenresHandler(db)))
+	router.HandleFunc("/tags", BasicAuthMiddleware(db, getTagsHandler(db)))
+
+	router.HandleFunc("GET /trash", BasicAuthMiddleware(db, getTrashHandler(db, cfg)))
+	router.HandleFunc("POST /trash/restore", BasicAuthMiddleware(db, restoreFromTrashHandler(db)))
+
+	router.HandleFunc("GET /audit", BasicAuthMiddleware(db, getAuditLogHandler(db)))
+	router.HandleFunc("GET /audit/export", BasicAuthMiddleware(db, exportAuditLogHandler(db)))
+
+	router.HandleFunc("GET /media/{key...}", BasicAuthMiddleware(db, getMediaHandler(media)))
+
+	router.HandleFunc("GET /metrics", BasicAuthMiddleware(db, getMetricsHandler(db)))
+
+	return requestIDMiddleware(tracingMiddleware(router, metricsMiddleware(router, accessLogMiddleware(router))))
 }
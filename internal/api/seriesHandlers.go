@@ -0,0 +1,911 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"log/slog"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/validation"
+	"net/http"
+	"strconv"
+)
+
+// SeriesRequest is the body of series create and update requests. On update,
+// empty fields keep their current values.
+type SeriesRequest struct {
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+	FirstAirDate string `json:"first_air_date,omitempty"`
+	LastAirDate  string `json:"last_air_date,omitempty"`
+	Rating       string `json:"rating,omitempty"`
+}
+
+type SeasonRequest struct {
+	SeriesID    int    `json:"series_id,omitempty"`
+	Number      int    `json:"number,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type EpisodeRequest struct {
+	SeasonID       int    `json:"season_id,omitempty"`
+	Number         int    `json:"number,omitempty"`
+	Name           string `json:"name,omitempty"`
+	Description    string `json:"description,omitempty"`
+	AirDate        string `json:"air_date,omitempty"`
+	RuntimeMinutes int    `json:"runtime_minutes,omitempty"`
+	Rating         string `json:"rating,omitempty"`
+	// GuestCast replaces the episode's guest cast when present.
+	GuestCast []GuestCastRequest `json:"guest_cast,omitempty"`
+	// CreateMissingActors creates guest actors referenced by an unknown name.
+	CreateMissingActors bool `json:"create_missing_actors,omitempty"`
+}
+
+// GuestCastRequest references an existing actor by actor_id or name.
+type GuestCastRequest struct {
+	ActorID    int      `json:"actor_id,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	Characters []string `json:"characters,omitempty"`
+}
+
+func createSeriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var seriesReq SeriesRequest
+		if err := json.NewDecoder(r.Body).Decode(&seriesReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding series request on creating", "error", err)
+			return
+		}
+		if !validation.Name(seriesReq.Name) || !validSeriesRequest(seriesReq) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var series SeriesResponse
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			var seriesID int
+			err := tx.QueryRowContext(r.Context(), `INSERT INTO series (name, description, first_air_date, last_air_date, rating)
+				VALUES ($1, NULLIF($2, ''), NULLIF($3, '')::date, NULLIF($4, '')::date, NULLIF($5, '')::float)
+				RETURNING series_id`,
+				seriesReq.Name, seriesReq.Description, seriesReq.FirstAirDate, seriesReq.LastAirDate, seriesReq.Rating).
+				Scan(&seriesID)
+			if err != nil {
+				return fmt.Errorf("inserting series: %w", err)
+			}
+			series, err = fetchSeries(r.Context(), tx, seriesID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error creating series:")
+			return
+		}
+
+		w.Header().Set("Location", "/series/get?id="+strconv.Itoa(series.ID))
+		if err := writeJSON(w, http.StatusCreated, series); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding created series", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to create series")
+	}
+}
+
+func updateSeriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		seriesID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var seriesReq SeriesRequest
+		if err := json.NewDecoder(r.Body).Decode(&seriesReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding series request on updating", "error", err)
+			return
+		}
+		if (seriesReq.Name != "" && !validation.Name(seriesReq.Name)) || !validSeriesRequest(seriesReq) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var series SeriesResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			result, err := tx.ExecContext(r.Context(), `UPDATE series SET
+					name = COALESCE(NULLIF($1, ''), name),
+					description = COALESCE(NULLIF($2, ''), description),
+					first_air_date = COALESCE(NULLIF($3, '')::date, first_air_date),
+					last_air_date = COALESCE(NULLIF($4, '')::date, last_air_date),
+					rating = COALESCE(NULLIF($5, '')::float, rating)
+				WHERE series_id = $6`,
+				seriesReq.Name, seriesReq.Description, seriesReq.FirstAirDate, seriesReq.LastAirDate, seriesReq.Rating, seriesID)
+			if err != nil {
+				return fmt.Errorf("updating series: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return sql.ErrNoRows
+			}
+			series, err = fetchSeries(r.Context(), tx, seriesID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error updating series:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, series); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding updated series", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to update series")
+	}
+}
+
+// deleteSeriesHandler deletes a series together with its seasons and episodes.
+func deleteSeriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		seriesID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			if err := deleteSeasons(r.Context(), tx, "series_id = $1", seriesID); err != nil {
+				return err
+			}
+			result, err := tx.ExecContext(r.Context(), "DELETE FROM series WHERE series_id=$1", seriesID)
+			if err != nil {
+				return fmt.Errorf("deleting series: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting series:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete series")
+	}
+}
+
+func getSeriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seriesID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		series, err := fetchSeries(r.Context(), db, seriesID)
+		if err != nil {
+			writeError(w, r, err, "Error getting series from database:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, series); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding series response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get series")
+	}
+}
+
+func getSeriesListHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var orderBy string
+		switch r.URL.Query().Get("sort") {
+		case "title":
+			orderBy = "s.name"
+		case "first_air_date":
+			orderBy = "s.first_air_date DESC NULLS LAST"
+		default:
+			orderBy = "s.rating DESC NULLS LAST"
+		}
+
+		series, err := querySeries(r.Context(), db, `SELECT `+seriesColumns+` FROM series s ORDER BY `+orderBy)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting series from database", "error", err)
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, series); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding series response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get series list")
+	}
+}
+
+// searchSeriesHandler finds series by title, episode title or guest actor name.
+func searchSeriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		var filter sqlFilter
+		pattern := filter.arg(query)
+		filter.where(`(s.name ILIKE '%' || ` + pattern + ` || '%' OR
+			EXISTS(
+				SELECT 1
+				FROM seasons se
+				JOIN episodes e ON e.season_id = se.season_id
+				LEFT JOIN episodes_actors ea ON ea.episode_id = e.episode_id
+				LEFT JOIN actors a ON a.actor_id = ea.actor_id AND a.deleted_at IS NULL
+				WHERE se.series_id = s.series_id AND (e.name ILIKE '%' || ` + pattern + ` || '%' OR ` + actorNameMatches(pattern) + `)
+			))`)
+
+		series, err := querySeries(r.Context(), db, `SELECT `+seriesColumns+` FROM series s`+filter.clause()+` ORDER BY s.name`,
+			filter.args...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error searching series in database", "error", err)
+			return
+		}
+		if len(series) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, series); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding searched series", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to search series", "query", query)
+	}
+}
+
+func createSeasonHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var seasonReq SeasonRequest
+		if err := json.NewDecoder(r.Body).Decode(&seasonReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding season request on creating", "error", err)
+			return
+		}
+		if seasonReq.SeriesID <= 0 || seasonReq.Number <= 0 || !validSeasonRequest(seasonReq) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var season SeasonResponse
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			var exists bool
+			err := tx.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM series WHERE series_id = $1)", seasonReq.SeriesID).
+				Scan(&exists)
+			if err != nil {
+				return fmt.Errorf("checking series: %w", err)
+			}
+			if !exists {
+				return newStatusError(http.StatusUnprocessableEntity, "series %d does not exist", seasonReq.SeriesID)
+			}
+			if err := ensureSeasonNumberFree(r.Context(), tx, seasonReq.SeriesID, seasonReq.Number, 0); err != nil {
+				return err
+			}
+			var seasonID int
+			err = tx.QueryRowContext(r.Context(), `INSERT INTO seasons (series_id, number, name, description)
+				VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, '')) RETURNING season_id`,
+				seasonReq.SeriesID, seasonReq.Number, seasonReq.Name, seasonReq.Description).Scan(&seasonID)
+			if err != nil {
+				return fmt.Errorf("inserting season: %w", err)
+			}
+			season, err = fetchSeason(r.Context(), tx, seasonID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error creating season:")
+			return
+		}
+
+		w.Header().Set("Location", "/seasons/get?id="+strconv.Itoa(season.ID))
+		if err := writeJSON(w, http.StatusCreated, season); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding created season", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to create season")
+	}
+}
+
+func updateSeasonHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		seasonID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var seasonReq SeasonRequest
+		if err := json.NewDecoder(r.Body).Decode(&seasonReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding season request on updating", "error", err)
+			return
+		}
+		if seasonReq.Number < 0 || !validSeasonRequest(seasonReq) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var season SeasonResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			var seriesID int
+			err := tx.QueryRowContext(r.Context(), "SELECT series_id FROM seasons WHERE season_id = $1 FOR UPDATE", seasonID).
+				Scan(&seriesID)
+			if err != nil {
+				return err
+			}
+			if seasonReq.Number != 0 {
+				if err := ensureSeasonNumberFree(r.Context(), tx, seriesID, seasonReq.Number, seasonID); err != nil {
+					return err
+				}
+			}
+			_, err = tx.ExecContext(r.Context(), `UPDATE seasons SET
+					number = COALESCE(NULLIF($1, 0), number),
+					name = COALESCE(NULLIF($2, ''), name),
+					description = COALESCE(NULLIF($3, ''), description)
+				WHERE season_id = $4`, seasonReq.Number, seasonReq.Name, seasonReq.Description, seasonID)
+			if err != nil {
+				return fmt.Errorf("updating season: %w", err)
+			}
+			season, err = fetchSeason(r.Context(), tx, seasonID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error updating season:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, season); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding updated season", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to update season")
+	}
+}
+
+// deleteSeasonHandler deletes a season together with its episodes.
+func deleteSeasonHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		seasonID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			var exists bool
+			err := tx.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM seasons WHERE season_id = $1)", seasonID).Scan(&exists)
+			if err != nil {
+				return fmt.Errorf("checking season: %w", err)
+			}
+			if !exists {
+				return sql.ErrNoRows
+			}
+			return deleteSeasons(r.Context(), tx, "season_id = $1", seasonID)
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting season:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete season")
+	}
+}
+
+func getSeasonHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seasonID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		season, err := fetchSeason(r.Context(), db, seasonID)
+		if err != nil {
+			writeError(w, r, err, "Error getting season from database:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, season); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding season response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get season")
+	}
+}
+
+func createEpisodeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var episodeReq EpisodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&episodeReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding episode request on creating", "error", err)
+			return
+		}
+		if episodeReq.SeasonID <= 0 || episodeReq.Number <= 0 || !validation.Name(episodeReq.Name) ||
+			!validEpisodeRequest(episodeReq) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var episode EpisodeResponse
+		err := withTx(r.Context(), db, func(tx *sql.Tx) error {
+			var exists bool
+			err := tx.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM seasons WHERE season_id = $1)", episodeReq.SeasonID).
+				Scan(&exists)
+			if err != nil {
+				return fmt.Errorf("checking season: %w", err)
+			}
+			if !exists {
+				return newStatusError(http.StatusUnprocessableEntity, "season %d does not exist", episodeReq.SeasonID)
+			}
+			if err := ensureEpisodeNumberFree(r.Context(), tx, episodeReq.SeasonID, episodeReq.Number, 0); err != nil {
+				return err
+			}
+			var episodeID int
+			err = tx.QueryRowContext(r.Context(), `INSERT INTO episodes (season_id, number, name, description, air_date, runtime_minutes, rating)
+				VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, '')::date, NULLIF($6, 0), NULLIF($7, '')::float)
+				RETURNING episode_id`,
+				episodeReq.SeasonID, episodeReq.Number, episodeReq.Name, episodeReq.Description, episodeReq.AirDate,
+				episodeReq.RuntimeMinutes, episodeReq.Rating).Scan(&episodeID)
+			if err != nil {
+				return fmt.Errorf("inserting episode: %w", err)
+			}
+			if err := setEpisodeGuestCast(r.Context(), tx, episodeID, episodeReq.GuestCast, episodeReq.CreateMissingActors); err != nil {
+				return err
+			}
+			episode, err = fetchEpisode(r.Context(), tx, episodeID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error creating episode:")
+			return
+		}
+
+		w.Header().Set("Location", "/episodes/get?id="+strconv.Itoa(episode.ID))
+		if err := writeJSON(w, http.StatusCreated, episode); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding created episode", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to create episode")
+	}
+}
+
+func updateEpisodeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		episodeID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var episodeReq EpisodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&episodeReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding episode request on updating", "error", err)
+			return
+		}
+		if episodeReq.Number < 0 || (episodeReq.Name != "" && !validation.Name(episodeReq.Name)) || !validEpisodeRequest(episodeReq) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		var episode EpisodeResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			var seasonID int
+			err := tx.QueryRowContext(r.Context(), "SELECT season_id FROM episodes WHERE episode_id = $1 FOR UPDATE", episodeID).
+				Scan(&seasonID)
+			if err != nil {
+				return err
+			}
+			if episodeReq.Number != 0 {
+				if err := ensureEpisodeNumberFree(r.Context(), tx, seasonID, episodeReq.Number, episodeID); err != nil {
+					return err
+				}
+			}
+			_, err = tx.ExecContext(r.Context(), `UPDATE episodes SET
+					number = COALESCE(NULLIF($1, 0), number),
+					name = COALESCE(NULLIF($2, ''), name),
+					description = COALESCE(NULLIF($3, ''), description),
+					air_date = COALESCE(NULLIF($4, '')::date, air_date),
+					runtime_minutes = COALESCE(NULLIF($5, 0), runtime_minutes),
+					rating = COALESCE(NULLIF($6, '')::float, rating)
+				WHERE episode_id = $7`,
+				episodeReq.Number, episodeReq.Name, episodeReq.Description, episodeReq.AirDate, episodeReq.RuntimeMinutes,
+				episodeReq.Rating, episodeID)
+			if err != nil {
+				return fmt.Errorf("updating episode: %w", err)
+			}
+			if episodeReq.GuestCast != nil {
+				if err := setEpisodeGuestCast(r.Context(), tx, episodeID, episodeReq.GuestCast, episodeReq.CreateMissingActors); err != nil {
+					return err
+				}
+			}
+			episode, err = fetchEpisode(r.Context(), tx, episodeID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error updating episode:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, episode); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding updated episode", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to update episode")
+	}
+}
+
+func deleteEpisodeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		episodeID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(r.Context(), "DELETE FROM episodes_actors WHERE episode_id=$1", episodeID); err != nil {
+				return fmt.Errorf("deleting episode guest cast: %w", err)
+			}
+			result, err := tx.ExecContext(r.Context(), "DELETE FROM episodes WHERE episode_id=$1", episodeID)
+			if err != nil {
+				return fmt.Errorf("deleting episode: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting episode:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete episode")
+	}
+}
+
+func getEpisodeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		episodeID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		episode, err := fetchEpisode(r.Context(), db, episodeID)
+		if err != nil {
+			writeError(w, r, err, "Error getting episode from database:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, episode); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding episode response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get episode")
+	}
+}
+
+// getEpisodesHandler lists episodes in airing order, filtered by series,
+// season or guest actor.
+func getEpisodesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var filter sqlFilter
+		for param, column := range map[string]string{"series_id": "se.series_id", "season_id": "e.season_id"} {
+			if r.URL.Query().Get(param) == "" {
+				continue
+			}
+			id, err := idFromQuery(r, param)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			filter.where(column + " = " + filter.arg(id))
+		}
+		if r.URL.Query().Get("actor_id") != "" {
+			actorID, err := idFromQuery(r, "actor_id")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			filter.where("EXISTS (SELECT 1 FROM episodes_actors ea WHERE ea.episode_id = e.episode_id AND ea.actor_id = " +
+				filter.arg(actorID) + ")")
+		}
+
+		rows, err := db.QueryContext(r.Context(), `SELECT `+episodeColumns+`
+			FROM episodes e
+			JOIN seasons se ON se.season_id = e.season_id`+filter.clause()+`
+			ORDER BY se.series_id, se.number, e.number`, filter.args...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting episodes from database", "error", err)
+			return
+		}
+		defer rows.Close()
+
+		episodes := []EpisodeResponse{}
+		for rows.Next() {
+			episode, err := scanEpisode(rows)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Error scanning episodes", "error", err)
+				return
+			}
+			episodes = append(episodes, episode)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error reading episodes", "error", err)
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, episodes); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding episodes response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get episodes")
+	}
+}
+
+func validSeriesRequest(seriesReq SeriesRequest) bool {
+	return validation.Description(seriesReq.Description) &&
+		(seriesReq.FirstAirDate == "" || validation.Date(seriesReq.FirstAirDate)) &&
+		(seriesReq.LastAirDate == "" || validation.Date(seriesReq.LastAirDate)) &&
+		(seriesReq.Rating == "" || validation.Rating(seriesReq.Rating))
+}
+
+func validSeasonRequest(seasonReq SeasonRequest) bool {
+	return (seasonReq.Name == "" || validation.Name(seasonReq.Name)) && validation.Description(seasonReq.Description)
+}
+
+func validEpisodeRequest(episodeReq EpisodeRequest) bool {
+	if !validation.Description(episodeReq.Description) ||
+		(episodeReq.AirDate != "" && !validation.Date(episodeReq.AirDate)) ||
+		(episodeReq.RuntimeMinutes != 0 && !validation.RuntimeMinutes(episodeReq.RuntimeMinutes)) ||
+		(episodeReq.Rating != "" && !validation.Rating(episodeReq.Rating)) {
+		return false
+	}
+	for _, guest := range episodeReq.GuestCast {
+		if !(ActorRef{ID: guest.ActorID, Name: guest.Name}).valid() {
+			return false
+		}
+		for _, character := range guest.Characters {
+			if !validation.Name(character) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func ensureSeasonNumberFree(ctx context.Context, tx *sql.Tx, seriesID, number, seasonID int) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM seasons WHERE series_id = $1 AND number = $2 AND season_id <> $3)",
+		seriesID, number, seasonID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("checking season number: %w", err)
+	}
+	if exists {
+		return newStatusError(http.StatusConflict, "season %d already exists", number)
+	}
+	return nil
+}
+
+func ensureEpisodeNumberFree(ctx context.Context, tx *sql.Tx, seasonID, number, episodeID int) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM episodes WHERE season_id = $1 AND number = $2 AND episode_id <> $3)",
+		seasonID, number, episodeID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("checking episode number: %w", err)
+	}
+	if exists {
+		return newStatusError(http.StatusConflict, "episode %d already exists in the season", number)
+	}
+	return nil
+}
+
+// deleteSeasons deletes the seasons matching condition, whose only argument
+// is arg, together with their episodes and guest cast.
+func deleteSeasons(ctx context.Context, tx *sql.Tx, condition string, arg int) error {
+	seasons := `SELECT season_id FROM seasons WHERE ` + condition
+	_, err := tx.ExecContext(ctx, `DELETE FROM episodes_actors
+		WHERE episode_id IN (SELECT episode_id FROM episodes WHERE season_id IN (`+seasons+`))`, arg)
+	if err != nil {
+		return fmt.Errorf("deleting episode guest cast: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM episodes WHERE season_id IN (`+seasons+`)`, arg); err != nil {
+		return fmt.Errorf("deleting episodes: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM seasons WHERE `+condition, arg); err != nil {
+		return fmt.Errorf("deleting seasons: %w", err)
+	}
+	return nil
+}
+
+// setEpisodeGuestCast replaces the guest cast of an episode, resolving
+// actors the same way movie cast references are resolved.
+func setEpisodeGuestCast(ctx context.Context, tx *sql.Tx, episodeID int, guests []GuestCastRequest, createMissing bool) error {
+	refs := make([]ActorRef, len(guests))
+	for i, guest := range guests {
+		refs[i] = ActorRef{ID: guest.ActorID, Name: guest.Name}
+	}
+	actorIDs, err := resolveActorRefs(ctx, tx, refs, createMissing)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM episodes_actors WHERE episode_id = $1", episodeID); err != nil {
+		return fmt.Errorf("deleting episode guest cast: %w", err)
+	}
+	for i, actorID := range actorIDs {
+		characters := guests[i].Characters
+		if characters == nil {
+			characters = []string{}
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO episodes_actors (episode_id, actor_id, characters) VALUES ($1, $2, $3)
+			ON CONFLICT (episode_id, actor_id) DO UPDATE SET characters = EXCLUDED.characters`,
+			episodeID, actorID, pq.Array(characters))
+		if err != nil {
+			return fmt.Errorf("inserting episode guest: %w", err)
+		}
+	}
+	return nil
+}
+
+// seriesColumns is the select list, over series aliased as s, scanned by scanSeries.
+const seriesColumns = `s.series_id, s.name, COALESCE(s.description, ''),
+	COALESCE(to_char(s.first_air_date, 'YYYY-MM-DD'), ''), COALESCE(to_char(s.last_air_date, 'YYYY-MM-DD'), ''),
+	COALESCE(s.rating, 0),
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'id', se.season_id,
+			'number', se.number,
+			'name', COALESCE(se.name, ''),
+			'episode_count', (SELECT COUNT(*) FROM episodes e WHERE e.season_id = se.season_id)
+		) ORDER BY se.number)
+		FROM seasons se
+		WHERE se.series_id = s.series_id
+	), '[]')`
+
+func scanSeries(row rowScanner) (SeriesResponse, error) {
+	var series SeriesResponse
+	var seasonsJSON []byte
+	err := row.Scan(&series.ID, &series.Name, &series.Description, &series.FirstAirDate, &series.LastAirDate,
+		&series.Rating, &seasonsJSON)
+	if err != nil {
+		return series, err
+	}
+	if err := json.Unmarshal(seasonsJSON, &series.Seasons); err != nil {
+		return series, fmt.Errorf("unmarshalling seasons JSON: %w", err)
+	}
+	return series, nil
+}
+
+func querySeries(ctx context.Context, q queryer, query string, args ...interface{}) ([]SeriesResponse, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seriesList := []SeriesResponse{}
+	for rows.Next() {
+		series, err := scanSeries(rows)
+		if err != nil {
+			return nil, err
+		}
+		seriesList = append(seriesList, series)
+	}
+	return seriesList, rows.Err()
+}
+
+func fetchSeries(ctx context.Context, q queryer, seriesID int) (SeriesResponse, error) {
+	return scanSeries(q.QueryRowContext(ctx, `SELECT `+seriesColumns+` FROM series s WHERE s.series_id = $1`, seriesID))
+}
+
+// seasonColumns is the select list, over seasons aliased as se, scanned by fetchSeason.
+const seasonColumns = `se.season_id, se.series_id, se.number, COALESCE(se.name, ''), COALESCE(se.description, ''),
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'id', e.episode_id,
+			'number', e.number,
+			'name', e.name,
+			'air_date', COALESCE(to_char(e.air_date, 'YYYY-MM-DD'), '')
+		) ORDER BY e.number)
+		FROM episodes e
+		WHERE e.season_id = se.season_id
+	), '[]')`
+
+func fetchSeason(ctx context.Context, q queryer, seasonID int) (SeasonResponse, error) {
+	var season SeasonResponse
+	var episodesJSON []byte
+	err := q.QueryRowContext(ctx, `SELECT `+seasonColumns+` FROM seasons se WHERE se.season_id = $1`, seasonID).
+		Scan(&season.ID, &season.SeriesID, &season.Number, &season.Name, &season.Description, &episodesJSON)
+	if err != nil {
+		return season, err
+	}
+	if err := json.Unmarshal(episodesJSON, &season.Episodes); err != nil {
+		return season, fmt.Errorf("unmarshalling episodes JSON: %w", err)
+	}
+	return season, nil
+}
+
+// episodeColumns is the select list, over episodes aliased as e joined with
+// their season aliased as se, scanned by scanEpisode.
+const episodeColumns = `e.episode_id, se.series_id, e.season_id, se.number, e.number, e.name, COALESCE(e.description, ''),
+	COALESCE(to_char(e.air_date, 'YYYY-MM-DD'), ''), COALESCE(e.runtime_minutes, 0), COALESCE(e.rating, 0),
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'actor_id', a.actor_id,
+			'name', a.name,
+			'characters', ea.characters
+		) ORDER BY a.name)
+		FROM actors a
+		JOIN episodes_actors ea ON a.actor_id = ea.actor_id
+		WHERE ea.episode_id = e.episode_id AND a.deleted_at IS NULL
+	), '[]')`
+
+func scanEpisode(row rowScanner) (EpisodeResponse, error) {
+	var episode EpisodeResponse
+	var guestCastJSON []byte
+	err := row.Scan(&episode.ID, &episode.SeriesID, &episode.SeasonID, &episode.SeasonNumber, &episode.Number, &episode.Name,
+		&episode.Description, &episode.AirDate, &episode.RuntimeMinutes, &episode.Rating, &guestCastJSON)
+	if err != nil {
+		return episode, err
+	}
+	if err := json.Unmarshal(guestCastJSON, &episode.GuestCast); err != nil {
+		return episode, fmt.Errorf("unmarshalling guest cast JSON: %w", err)
+	}
+	return episode, nil
+}
+
+func fetchEpisode(ctx context.Context, q queryer, episodeID int) (EpisodeResponse, error) {
+	return scanEpisode(q.QueryRowContext(ctx, `SELECT `+episodeColumns+`
+		FROM episodes e
+		JOIN seasons se ON se.season_id = e.season_id
+		WHERE e.episode_id = $1`, episodeID))
+}
@@ -0,0 +1,492 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"log/slog"
+	"movieLibrary/internal/config"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/validation"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxLanguages bounds the fallback chain built from a single request.
+const maxLanguages = 10
+
+// TranslationRequest is the body of translation upserts. Actor translations
+// only use Name.
+type TranslationRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+func getMovieTranslationsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := ensureMovieExists(r.Context(), db, movieID); err != nil {
+			writeError(w, r, err, "Error checking movie:")
+			return
+		}
+
+		translations, err := queryTranslations(r.Context(), db, `SELECT language, name, COALESCE(description, '')
+			FROM movie_translations WHERE movie_id = $1 ORDER BY language`, movieID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting movie translations from database", "error", err)
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, translations); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movie translations", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get movie translations")
+	}
+}
+
+// putMovieTranslationHandler creates or replaces the translation of a movie's
+// title and description into the language given by the lang parameter.
+func putMovieTranslationHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		language, err := languageFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var translationReq TranslationRequest
+		if err := json.NewDecoder(r.Body).Decode(&translationReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding movie translation request", "error", err)
+			return
+		}
+		if !validation.Name(translationReq.Name) || !validation.Description(translationReq.Description) {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		_, err = editMovie(r, db, cfg, movieID, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(r.Context(), `INSERT INTO movie_translations (movie_id, language, name, description)
+				VALUES ($1, $2, $3, NULLIF($4, ''))
+				ON CONFLICT (movie_id, language) DO UPDATE SET name = EXCLUDED.name, description = EXCLUDED.description`,
+				movieID, language, translationReq.Name, translationReq.Description)
+			if err != nil {
+				return fmt.Errorf("saving movie translation: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error saving movie translation:")
+			return
+		}
+
+		translation := TranslationResponse{Language: language, Name: translationReq.Name, Description: translationReq.Description}
+		if err := writeJSON(w, http.StatusOK, translation); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding movie translation", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to save movie translation")
+	}
+}
+
+func deleteMovieTranslationHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		language, err := languageFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_, err = editMovie(r, db, cfg, movieID, func(tx *sql.Tx) error {
+			result, err := tx.ExecContext(r.Context(), "DELETE FROM movie_translations WHERE movie_id = $1 AND language = $2",
+				movieID, language)
+			if err != nil {
+				return fmt.Errorf("deleting movie translation: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting movie translation:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete movie translation")
+	}
+}
+
+func getActorTranslationsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actorID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := fetchActor(r.Context(), db, actorID); err != nil {
+			writeError(w, r, err, "Error checking actor:")
+			return
+		}
+
+		translations, err := queryTranslations(r.Context(), db, `SELECT language, name, ''
+			FROM actor_translations WHERE actor_id = $1 ORDER BY language`, actorID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting actor translations from database", "error", err)
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, translations); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding actor translations", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get actor translations")
+	}
+}
+
+// putActorTranslationHandler creates or replaces the actor's name as written
+// in the language or script given by the lang parameter.
+func putActorTranslationHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		actorID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		language, err := languageFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var translationReq TranslationRequest
+		if err := json.NewDecoder(r.Body).Decode(&translationReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding actor translation request", "error", err)
+			return
+		}
+		if !validation.Name(translationReq.Name) || translationReq.Description != "" {
+			http.Error(w, "Bad request body", http.StatusBadRequest)
+			return
+		}
+
+		_, err = editActor(r, db, cfg, actorID, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(r.Context(), `INSERT INTO actor_translations (actor_id, language, name) VALUES ($1, $2, $3)
+				ON CONFLICT (actor_id, language) DO UPDATE SET name = EXCLUDED.name`,
+				actorID, language, translationReq.Name)
+			if err != nil {
+				return fmt.Errorf("saving actor translation: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error saving actor translation:")
+			return
+		}
+
+		translation := TranslationResponse{Language: language, Name: translationReq.Name}
+		if err := writeJSON(w, http.StatusOK, translation); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding actor translation", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to save actor translation")
+	}
+}
+
+func deleteActorTranslationHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		actorID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		language, err := languageFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_, err = editActor(r, db, cfg, actorID, func(tx *sql.Tx) error {
+			result, err := tx.ExecContext(r.Context(), "DELETE FROM actor_translations WHERE actor_id = $1 AND language = $2",
+				actorID, language)
+			if err != nil {
+				return fmt.Errorf("deleting actor translation: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		})
+		if err != nil {
+			writeError(w, r, err, "Error deleting actor translation:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to delete actor translation")
+	}
+}
+
+// languageFromQuery reads the single language tag a translation is stored
+// under from the lang parameter.
+func languageFromQuery(r *http.Request) (string, error) {
+	language := normalizeLanguageTag(r.URL.Query().Get("lang"))
+	if !validation.LanguageTag(language) {
+		return "", fmt.Errorf("invalid lang parameter: %q", r.URL.Query().Get("lang"))
+	}
+	return language, nil
+}
+
+// normalizeLanguageTag canonicalises the case of a tag such as "pt-br" to "pt-BR".
+func normalizeLanguageTag(tag string) string {
+	tag = strings.TrimSpace(tag)
+	base, region, found := strings.Cut(tag, "-")
+	if !found {
+		return strings.ToLower(base)
+	}
+	return strings.ToLower(base) + "-" + strings.ToUpper(region)
+}
+
+// requestLanguages returns the languages the client prefers, most preferred
+// first. The lang parameter, a comma separated list, takes precedence over
+// the Accept-Language header. Each regional tag is followed by its base
+// language, so "pt-BR" falls back to "pt"; when nothing matches, the
+// untranslated values are shown.
+func requestLanguages(r *http.Request) []string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+	var candidates []weighted
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		for _, tag := range splitList(lang) {
+			candidates = append(candidates, weighted{tag: tag, quality: 1})
+		}
+	} else {
+		for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+			tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			quality := 1.0
+			if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					continue
+				}
+				quality = parsed
+			}
+			if tag == "" || tag == "*" || quality <= 0 {
+				continue
+			}
+			candidates = append(candidates, weighted{tag: tag, quality: quality})
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].quality > candidates[j].quality })
+	}
+
+	var languages []string
+	seen := map[string]bool{}
+	add := func(tag string) {
+		if !seen[tag] && validation.LanguageTag(tag) && len(languages) < maxLanguages {
+			seen[tag] = true
+			languages = append(languages, tag)
+		}
+	}
+	for _, candidate := range candidates {
+		tag := normalizeLanguageTag(candidate.tag)
+		add(tag)
+		if base, _, found := strings.Cut(tag, "-"); found {
+			add(base)
+		}
+	}
+	return languages
+}
+
+// setLanguageHeaders marks a response as negotiated on the request language
+// and, when a translation was applied, names its language.
+func setLanguageHeaders(w http.ResponseWriter, language string) {
+	w.Header().Add("Vary", "Accept-Language")
+	if language != "" {
+		w.Header().Set("Content-Language", language)
+	}
+}
+
+func queryTranslations(ctx context.Context, q queryer, query string, args ...interface{}) ([]TranslationResponse, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []TranslationResponse{}
+	for rows.Next() {
+		var translation TranslationResponse
+		if err := rows.Scan(&translation.Language, &translation.Name, &translation.Description); err != nil {
+			return nil, err
+		}
+		translations = append(translations, translation)
+	}
+	return translations, rows.Err()
+}
+
+// preferredTranslations runs query, which selects id, language, name and
+// description for ids in $1 and languages in $2, and keeps for every id the
+// translation earliest in languages.
+func preferredTranslations(ctx context.Context, q queryer, query string, ids []int, languages []string) (map[int]TranslationResponse, error) {
+	preferred := map[int]TranslationResponse{}
+	if len(ids) == 0 || len(languages) == 0 {
+		return preferred, nil
+	}
+	rank := make(map[string]int, len(languages))
+	for i, language := range languages {
+		rank[language] = i
+	}
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids), pq.Array(languages))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var translation TranslationResponse
+		if err := rows.Scan(&id, &translation.Language, &translation.Name, &translation.Description); err != nil {
+			return nil, err
+		}
+		if current, ok := preferred[id]; !ok || rank[translation.Language] < rank[current.Language] {
+			preferred[id] = translation
+		}
+	}
+	return preferred, rows.Err()
+}
+
+// localizeMovies replaces the title, description and cast names of movies
+// with their translations into the preferred languages, where present.
+func localizeMovies(ctx context.Context, q queryer, languages []string, movies []MovieResponse) error {
+	if len(languages) == 0 {
+		return nil
+	}
+	var movieIDs, actorIDs []int
+	for _, movie := range movies {
+		movieIDs = append(movieIDs, movie.ID)
+		for _, member := range movie.Cast {
+			actorIDs = append(actorIDs, member.ActorID)
+		}
+	}
+	titles, err := preferredTranslations(ctx, q, `SELECT movie_id, language, name, COALESCE(description, '')
+		FROM movie_translations WHERE movie_id = ANY($1) AND language = ANY($2)`, movieIDs, languages)
+	if err != nil {
+		return fmt.Errorf("reading movie translations: %w", err)
+	}
+	names, err := preferredTranslations(ctx, q, `SELECT actor_id, language, name, ''
+		FROM actor_translations WHERE actor_id = ANY($1) AND language = ANY($2)`, actorIDs, languages)
+	if err != nil {
+		return fmt.Errorf("reading actor translations: %w", err)
+	}
+
+	for i := range movies {
+		movie := &movies[i]
+		if title, ok := titles[movie.ID]; ok {
+			movie.Name = title.Name
+			if title.Description != "" {
+				movie.Description = title.Description
+			}
+			movie.Language = title.Language
+		}
+		renamed := map[string]string{}
+		for j, member := range movie.Cast {
+			if name, ok := names[member.ActorID]; ok {
+				renamed[member.Name] = name.Name
+				movie.Cast[j].Name = name.Name
+			}
+		}
+		for j, name := range movie.Actors {
+			if translated, ok := renamed[name]; ok {
+				movie.Actors[j] = translated
+			}
+		}
+	}
+	return nil
+}
+
+// localizeActors replaces actor names and the titles in their filmographies
+// with translations into the preferred languages, where present.
+func localizeActors(ctx context.Context, q queryer, languages []string, actors []ActorResponse) error {
+	if len(languages) == 0 {
+		return nil
+	}
+	var actorIDs, movieIDs []int
+	for _, actor := range actors {
+		actorIDs = append(actorIDs, actor.ID)
+		for _, entry := range actor.Filmography {
+			movieIDs = append(movieIDs, entry.MovieID)
+		}
+	}
+	names, err := preferredTranslations(ctx, q, `SELECT actor_id, language, name, ''
+		FROM actor_translations WHERE actor_id = ANY($1) AND language = ANY($2)`, actorIDs, languages)
+	if err != nil {
+		return fmt.Errorf("reading actor translations: %w", err)
+	}
+	titles, err := preferredTranslations(ctx, q, `SELECT movie_id, language, name, ''
+		FROM movie_translations WHERE movie_id = ANY($1) AND language = ANY($2)`, movieIDs, languages)
+	if err != nil {
+		return fmt.Errorf("reading movie translations: %w", err)
+	}
+
+	for i := range actors {
+		actor := &actors[i]
+		if name, ok := names[actor.ID]; ok {
+			actor.Name = name.Name
+			actor.Language = name.Language
+		}
+		renamed := map[string]string{}
+		for j, entry := range actor.Filmography {
+			if title, ok := titles[entry.MovieID]; ok {
+				renamed[entry.Name] = title.Name
+				actor.Filmography[j].Name = title.Name
+			}
+		}
+		for j, title := range actor.Movies {
+			if translated, ok := renamed[title]; ok {
+				actor.Movies[j] = translated
+			}
+		}
+	}
+	return nil
+}
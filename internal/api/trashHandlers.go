@@ -0,0 +1,352 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log/slog"
+	"movieLibrary/internal/config"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/storage"
+	"net/http"
+	"time"
+)
+
+// getTrashHandler lists the movies and actors in the trash, most recently
+// deleted first, together with the time the purge job will remove them.
+// The optional type parameter restricts the list to movies or actors.
+func getTrashHandler(db *sql.DB, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		itemType := r.URL.Query().Get("type")
+		if itemType != "" && itemType != "movie" && itemType != "actor" {
+			http.Error(w, "type must be movie or actor", http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.QueryContext(r.Context(), `SELECT type, id, name, deleted_at, deleted_at + make_interval(secs => $1)
+			FROM (
+				SELECT 'movie' AS type, movie_id AS id, name, deleted_at FROM movies WHERE deleted_at IS NOT NULL
+				UNION ALL
+				SELECT 'actor', actor_id, name, deleted_at FROM actors WHERE deleted_at IS NOT NULL
+			) trash
+			WHERE $2 = '' OR type = $2
+			ORDER BY deleted_at DESC, type, id`, cfg.TrashRetention.Seconds(), itemType)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting trash from database", "error", err)
+			return
+		}
+		defer rows.Close()
+
+		items := []TrashItemResponse{}
+		for rows.Next() {
+			var item TrashItemResponse
+			if err := rows.Scan(&item.Type, &item.ID, &item.Name, &item.DeletedAt, &item.PurgeAt); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Error scanning trash", "error", err)
+				return
+			}
+			items = append(items, item)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error reading trash", "error", err)
+			return
+		}
+
+		if err := writeJSONWithETag(w, r, items); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding trash response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get trash")
+	}
+}
+
+// restoreFromTrashHandler takes a movie or actor out of the trash. The links
+// kept while it was deleted, such as its cast or credits, become visible again.
+func restoreFromTrashHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if helpers2.GetRoleFromContext(r.Context()) != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		id, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var resource interface{}
+		var version int
+		switch r.URL.Query().Get("type") {
+		case "movie":
+			var movie MovieResponse
+			err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+				if err := restoreRow(r.Context(), tx, "movies", "movie_id", id); err != nil {
+					return err
+				}
+				if err := recordRevision(r.Context(), tx, movieEntity, id, "restore"); err != nil {
+					return err
+				}
+				var err error
+				movie, err = fetchMovie(r.Context(), tx, id)
+				return err
+			})
+			resource, version = movie, movie.Version
+		case "actor":
+			var actor ActorResponse
+			err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+				if err := restoreRow(r.Context(), tx, "actors", "actor_id", id); err != nil {
+					return err
+				}
+				if err := recordRevision(r.Context(), tx, actorEntity, id, "restore"); err != nil {
+					return err
+				}
+				if err := touchActorMovies(r.Context(), tx, id); err != nil {
+					return err
+				}
+				var err error
+				actor, err = fetchActor(r.Context(), tx, id)
+				return err
+			})
+			resource, version = actor, actor.Version
+		default:
+			http.Error(w, "type must be movie or actor", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeError(w, r, err, "Error restoring from trash:")
+			return
+		}
+
+		w.Header().Set("ETag", versionETag(version))
+		if err := writeJSON(w, http.StatusOK, resource); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding restored resource", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to restore from trash")
+	}
+}
+
+// restoreRow clears deleted_at of a trashed row of table, identified by its
+// key column, and bumps its version. Rows that are not in the trash yield
+// sql.ErrNoRows.
+func restoreRow(ctx context.Context, tx *sql.Tx, table, key string, id int) error {
+	result, err := tx.ExecContext(ctx, `UPDATE `+table+` SET deleted_at=NULL, version=version+1, updated_at=now()
+		WHERE `+key+`=$1 AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return fmt.Errorf("restoring from %s: %w", table, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// touchActorMovies bumps the version of every movie the actor appears in,
+// whose cast changes when the actor is deleted or restored, and records the
+// changed casts as revisions.
+func touchActorMovies(ctx context.Context, tx *sql.Tx, actorID int) error {
+	var movieIDs []int64
+	err := tx.QueryRowContext(ctx, `WITH touched AS (
+			UPDATE movies SET version=version+1, updated_at=now()
+			WHERE movie_id IN (SELECT movie_id FROM movies_actors WHERE actor_id=$1)
+			RETURNING movie_id
+		)
+		SELECT COALESCE(array_agg(movie_id ORDER BY movie_id), '{}') FROM touched`, actorID).Scan(pq.Array(&movieIDs))
+	if err != nil {
+		return fmt.Errorf("updating actor movie versions: %w", err)
+	}
+	return recordMovieRevisions(ctx, tx, movieIDs)
+}
+
+// StartPurgeJob removes movies and actors that have been in the trash for
+// longer than cfg.TrashRetention, once right away and then every
+// cfg.PurgeInterval until ctx is done.
+func StartPurgeJob(ctx context.Context, db *sql.DB, cfg config.Config, media storage.Store) {
+	if cfg.PurgeInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.PurgeInterval)
+		defer ticker.Stop()
+		for {
+			movies, actors, err := purgeTrash(ctx, db, cfg.TrashRetention, media)
+			if err != nil {
+				slog.ErrorContext(ctx, "Error purging trash", "error", err)
+			}
+			if movies > 0 || actors > 0 {
+				slog.InfoContext(ctx, "Purged trash", "movies", movies, "actors", actors)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// purgeTrash hard-deletes the items deleted more than retention ago, each in
+// its own transaction, and removes their images from media once committed.
+// Items restored in the meantime are skipped. An item that fails to purge is
+// logged and counted, and the run goes on with the rest.
+func purgeTrash(ctx context.Context, db *sql.DB, retention time.Duration, media storage.Store) (movies, actors int, err error) {
+	cutoff := time.Now().Add(-retention)
+	movieIDs, err := expiredIDs(ctx, db, "SELECT movie_id FROM movies WHERE deleted_at < $1 ORDER BY movie_id", cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, movieID := range movieIDs {
+		if purgeItem(ctx, db, media, "movie", movieID, func(tx *sql.Tx) (bool, []storedImage, error) {
+			return purgeMovie(ctx, tx, movieID, cutoff)
+		}) {
+			movies++
+		}
+	}
+
+	actorIDs, err := expiredIDs(ctx, db, "SELECT actor_id FROM actors WHERE deleted_at < $1 ORDER BY actor_id", cutoff)
+	if err != nil {
+		return movies, 0, err
+	}
+	for _, actorID := range actorIDs {
+		if purgeItem(ctx, db, media, "actor", actorID, func(tx *sql.Tx) (bool, []storedImage, error) {
+			return purgeActor(ctx, tx, actorID, cutoff)
+		}) {
+			actors++
+		}
+	}
+	return movies, actors, nil
+}
+
+// purgeItem runs purge, which deletes one item of the trash, in a transaction
+// and removes the images it returns once committed. It reports whether the
+// item was purged; failures are logged and counted rather than returned.
+func purgeItem(ctx context.Context, db *sql.DB, media storage.Store, itemType string, id int,
+	purge func(tx *sql.Tx) (bool, []storedImage, error)) bool {
+	var purged bool
+	var images []storedImage
+	err := withTx(ctx, db, func(tx *sql.Tx) error {
+		var err error
+		purged, images, err = purge(tx)
+		return err
+	})
+	if err != nil {
+		trashPurgeFailures.WithLabelValues(itemType).Inc()
+		slog.ErrorContext(ctx, "Error purging trash item", "type", itemType, "id", id, "error", err)
+		return false
+	}
+	deleteImageObjects(ctx, media, images)
+	return purged
+}
+
+// lockExpired locks the row of table identified by its key column if it is
+// still in the trash and was deleted before cutoff, and reports whether it is.
+// It keeps an item restored since it was selected for purging from being
+// deleted.
+func lockExpired(ctx context.Context, tx *sql.Tx, table, key string, id int, cutoff time.Time) (bool, error) {
+	var found int
+	err := tx.QueryRowContext(ctx, `SELECT 1 FROM `+table+`
+		WHERE `+key+`=$1 AND deleted_at IS NOT NULL AND deleted_at < $2 FOR UPDATE`, id, cutoff).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("locking %s: %w", table, err)
+	}
+	return true, nil
+}
+
+func expiredIDs(ctx context.Context, db *sql.DB, query string, cutoff time.Time) ([]int, error) {
+	rows, err := db.QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("reading expired trash: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scanning expired trash: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// purgeMovie hard-deletes a movie deleted before cutoff with everything that
+// refers to it and returns its images, whose objects the caller removes after
+// committing. It reports false, deleting nothing, if the movie is no longer
+// in the trash or was deleted since cutoff.
+func purgeMovie(ctx context.Context, tx *sql.Tx, movieID int, cutoff time.Time) (bool, []storedImage, error) {
+	if expired, err := lockExpired(ctx, tx, "movies", "movie_id", movieID, cutoff); err != nil || !expired {
+		return false, nil, err
+	}
+	images, err := deleteImages(ctx, tx, "movie_id = $1", movieID)
+	if err != nil {
+		return false, nil, err
+	}
+	statements := []struct {
+		query string
+		what  string
+	}{
+		{"DELETE FROM movies_actors WHERE movie_id=$1", "deleting movie actors"},
+		{"DELETE FROM movies_crew WHERE movie_id=$1", "deleting movie crew"},
+		{"DELETE FROM movies_genres WHERE movie_id=$1", "deleting movie genres"},
+		{"DELETE FROM movie_tags WHERE movie_id=$1", "deleting movie tags"},
+		{"DELETE FROM movie_translations WHERE movie_id=$1", "deleting movie translations"},
+		{"DELETE FROM movie_certifications WHERE movie_id=$1", "deleting movie certifications"},
+		{"DELETE FROM movie_ratings WHERE movie_id=$1", "deleting movie ratings"},
+		{"DELETE FROM reviews WHERE movie_id=$1", "deleting movie reviews"},
+		{"DELETE FROM watchlist WHERE movie_id=$1", "deleting watchlist entries"},
+		{"DELETE FROM watched WHERE movie_id=$1", "deleting watched entries"},
+		{"DELETE FROM collection_entries WHERE movie_id=$1", "deleting collection entries"},
+		{"DELETE FROM franchise_movies WHERE movie_id=$1", "deleting franchise membership"},
+		{"DELETE FROM movie_relations WHERE movie_id=$1 OR related_movie_id=$1", "deleting movie relations"},
+		{"DELETE FROM movies WHERE movie_id=$1", "deleting movie"},
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement.query, movieID); err != nil {
+			return false, nil, fmt.Errorf("%s: %w", statement.what, err)
+		}
+	}
+	return true, images, nil
+}
+
+// purgeActor hard-deletes an actor deleted before cutoff with its credits,
+// aliases and translations and returns its images, whose objects the caller
+// removes after committing. The history of actors merged into it is kept. It
+// reports false, deleting nothing, if the actor is no longer in the trash or
+// was deleted since cutoff.
+func purgeActor(ctx context.Context, tx *sql.Tx, actorID int, cutoff time.Time) (bool, []storedImage, error) {
+	if expired, err := lockExpired(ctx, tx, "actors", "actor_id", actorID, cutoff); err != nil || !expired {
+		return false, nil, err
+	}
+	images, err := deleteImages(ctx, tx, "actor_id = $1", actorID)
+	if err != nil {
+		return false, nil, err
+	}
+	statements := []struct {
+		query string
+		what  string
+	}{
+		{"DELETE FROM movies_actors WHERE actor_id=$1", "deleting actor credits"},
+		{"DELETE FROM episodes_actors WHERE actor_id=$1", "deleting actor guest credits"},
+		{"DELETE FROM actor_aliases WHERE actor_id=$1", "deleting actor aliases"},
+		{"DELETE FROM actor_translations WHERE actor_id=$1", "deleting actor translations"},
+		{"DELETE FROM actors WHERE actor_id=$1", "deleting actor"},
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement.query, actorID); err != nil {
+			return false, nil, fmt.Errorf("%s: %w", statement.what, err)
+		}
+	}
+	return true, images, nil
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"io"
+	"log/slog"
+	helpers2 "movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/validation"
+	"net/http"
+)
+
+// WatchedRequest is the optional body of a request marking a movie as
+// watched. WatchedOn defaults to today; RewatchCount defaults to one more
+// than before when the movie was already watched.
+type WatchedRequest struct {
+	WatchedOn    string `json:"watched_on,omitempty"`
+	RewatchCount *int   `json:"rewatch_count,omitempty"`
+}
+
+func addToWatchlistHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := helpers2.GetUsernameFromContext(r.Context())
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = ensureMovieExists(r.Context(), db, movieID)
+		if err == nil {
+			_, err = db.ExecContext(r.Context(), `INSERT INTO watchlist (username, movie_id) VALUES ($1, $2)
+				ON CONFLICT DO NOTHING`, username, movieID)
+		}
+		if err != nil {
+			writeError(w, r, err, "Error adding movie to watchlist:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to add movie to watchlist")
+	}
+}
+
+func removeFromWatchlistHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = deleteUserMovieEntry(r.Context(), db, "watchlist", helpers2.GetUsernameFromContext(r.Context()), movieID)
+		if err != nil {
+			writeError(w, r, err, "Error removing movie from watchlist:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to remove movie from watchlist")
+	}
+}
+
+// getWatchlistHandler lists the calling user's watchlist, most recently added first.
+func getWatchlistHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := db.QueryContext(r.Context(), `SELECT movie_id, added_at FROM watchlist
+			WHERE username = $1 AND movie_id IN (SELECT movie_id FROM movies WHERE deleted_at IS NULL)
+			ORDER BY added_at DESC, movie_id`, helpers2.GetUsernameFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting watchlist from database", "error", err)
+			return
+		}
+		defer rows.Close()
+
+		entries := []WatchlistEntryResponse{}
+		var movieIDs []int
+		for rows.Next() {
+			var entry WatchlistEntryResponse
+			if err := rows.Scan(&entry.Movie.ID, &entry.AddedAt); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Error scanning watchlist", "error", err)
+				return
+			}
+			entries = append(entries, entry)
+			movieIDs = append(movieIDs, entry.Movie.ID)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error reading watchlist", "error", err)
+			return
+		}
+		movies, err := moviesByID(r.Context(), db, movieIDs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting watchlist movies from database", "error", err)
+			return
+		}
+		for i := range entries {
+			entries[i].Movie = movies[entries[i].Movie.ID]
+		}
+
+		if err := writeJSONWithETag(w, r, entries); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding watchlist response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get watchlist")
+	}
+}
+
+// markWatchedHandler records that the calling user watched a movie and takes
+// it off their watchlist. Marking a watched movie again counts as a rewatch.
+func markWatchedHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := helpers2.GetUsernameFromContext(r.Context())
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var watchedReq WatchedRequest
+		if err := json.NewDecoder(r.Body).Decode(&watchedReq); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error decoding watched request", "error", err)
+			return
+		}
+		if watchedReq.WatchedOn != "" && !validation.Date(watchedReq.WatchedOn) {
+			http.Error(w, "Invalid watched_on date", http.StatusBadRequest)
+			return
+		}
+		if watchedReq.RewatchCount != nil && *watchedReq.RewatchCount < 0 {
+			http.Error(w, "Invalid rewatch_count", http.StatusBadRequest)
+			return
+		}
+
+		var entry WatchedEntryResponse
+		err = withTx(r.Context(), db, func(tx *sql.Tx) error {
+			if err := ensureMovieExists(r.Context(), tx, movieID); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(r.Context(), `INSERT INTO watched (username, movie_id, watched_on, rewatch_count)
+				VALUES ($1, $2, COALESCE(NULLIF($3, '')::date, current_date), COALESCE($4, 0))
+				ON CONFLICT (username, movie_id) DO UPDATE SET
+					watched_on = EXCLUDED.watched_on,
+					rewatch_count = COALESCE($4, watched.rewatch_count + 1)`,
+				username, movieID, watchedReq.WatchedOn, watchedReq.RewatchCount)
+			if err != nil {
+				return fmt.Errorf("marking movie watched: %w", err)
+			}
+			if _, err := tx.ExecContext(r.Context(), "DELETE FROM watchlist WHERE username=$1 AND movie_id=$2", username, movieID); err != nil {
+				return fmt.Errorf("removing watched movie from watchlist: %w", err)
+			}
+			err = tx.QueryRowContext(r.Context(), `SELECT to_char(watched_on, 'YYYY-MM-DD'), rewatch_count FROM watched
+				WHERE username = $1 AND movie_id = $2`, username, movieID).Scan(&entry.WatchedOn, &entry.RewatchCount)
+			if err != nil {
+				return err
+			}
+			entry.Movie, err = fetchMovie(r.Context(), tx, movieID)
+			return err
+		})
+		if err != nil {
+			writeError(w, r, err, "Error marking movie watched:")
+			return
+		}
+
+		if err := writeJSON(w, http.StatusOK, entry); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding watched response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to mark movie watched")
+	}
+}
+
+func unmarkWatchedHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		movieID, err := idFromQuery(r, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = deleteUserMovieEntry(r.Context(), db, "watched", helpers2.GetUsernameFromContext(r.Context()), movieID)
+		if err != nil {
+			writeError(w, r, err, "Error removing movie from watched history:")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		slog.DebugContext(r.Context(), "Received request to remove movie from watched history")
+	}
+}
+
+// getWatchedHandler lists the calling user's watched history, most recently watched first.
+func getWatchedHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rows, err := db.QueryContext(r.Context(), `SELECT movie_id, to_char(watched_on, 'YYYY-MM-DD'), rewatch_count FROM watched
+			WHERE username = $1 AND movie_id IN (SELECT movie_id FROM movies WHERE deleted_at IS NULL)
+			ORDER BY watched_on DESC, movie_id`, helpers2.GetUsernameFromContext(r.Context()))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting watched history from database", "error", err)
+			return
+		}
+		defer rows.Close()
+
+		entries := []WatchedEntryResponse{}
+		var movieIDs []int
+		for rows.Next() {
+			var entry WatchedEntryResponse
+			if err := rows.Scan(&entry.Movie.ID, &entry.WatchedOn, &entry.RewatchCount); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Error scanning watched history", "error", err)
+				return
+			}
+			entries = append(entries, entry)
+			movieIDs = append(movieIDs, entry.Movie.ID)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error reading watched history", "error", err)
+			return
+		}
+		movies, err := moviesByID(r.Context(), db, movieIDs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error getting watched movies from database", "error", err)
+			return
+		}
+		for i := range entries {
+			entries[i].Movie = movies[entries[i].Movie.ID]
+		}
+
+		if err := writeJSONWithETag(w, r, entries); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding watched history response", "error", err)
+		}
+
+		slog.DebugContext(r.Context(), "Received request to get watched history")
+	}
+}
+
+// deleteUserMovieEntry removes a movie from one of the per-user movie lists,
+// returning sql.ErrNoRows when it was not on the list.
+func deleteUserMovieEntry(ctx context.Context, db *sql.DB, table string, username string, movieID int) error {
+	result, err := db.ExecContext(ctx, "DELETE FROM "+table+" WHERE username=$1 AND movie_id=$2", username, movieID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func ensureMovieExists(ctx context.Context, q queryer, movieID int) error {
+	var exists bool
+	if err := q.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM movies WHERE movie_id = $1 AND deleted_at IS NULL)", movieID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// moviesByID reads the movies with the given IDs, keyed by ID.
+func moviesByID(ctx context.Context, q queryer, movieIDs []int) (map[int]MovieResponse, error) {
+	movies, err := queryMovies(ctx, q, `SELECT `+movieColumns+` FROM movies m
+		WHERE m.movie_id = ANY($1) AND m.deleted_at IS NULL`, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]MovieResponse, len(movies))
+	for _, movie := range movies {
+		byID[movie.ID] = movie
+	}
+	return byID, nil
+}
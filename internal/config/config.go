@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds the runtime settings of the application, read from the environment.
+type Config struct {
+	// RequireIfMatch makes updates and deletes of movies and actors fail with
+	// 428 Precondition Required when the If-Match header is missing.
+	RequireIfMatch bool
+	// MediaDir is the directory uploaded images are stored in.
+	MediaDir string
+	// MaxUploadBytes limits the size of a single image upload.
+	MaxUploadBytes int64
+	// TrashRetention is how long deleted movies and actors stay in the trash
+	// before the purge job removes them for good.
+	TrashRetention time.Duration
+	// PurgeInterval is how often the purge job runs. Zero disables it.
+	PurgeInterval time.Duration
+	// LogFormat is the format log records are written in, "json" or "text".
+	LogFormat string
+	// LogLevel is the least severe level that is logged.
+	LogLevel slog.Level
+	// TraceExporter is where spans are sent: "otlp", "stdout" or "none".
+	TraceExporter string
+}
+
+// Load reads the settings from the environment. Unset variables take their
+// defaults; a variable set to a value that does not parse is an error, listing
+// every such variable, rather than silently falling back to the default.
+func Load() (Config, error) {
+	var env envParser
+	cfg := Config{
+		RequireIfMatch: env.bool("REQUIRE_IF_MATCH", false),
+		MediaDir:       env.string("MEDIA_DIR", "media"),
+		MaxUploadBytes: env.int64("MAX_UPLOAD_BYTES", 10<<20),
+		TrashRetention: env.duration("TRASH_RETENTION", 30*24*time.Hour),
+		PurgeInterval:  env.duration("PURGE_INTERVAL", time.Hour),
+		LogFormat:      env.string("LOG_FORMAT", "text"),
+		LogLevel:       env.level("LOG_LEVEL", slog.LevelInfo),
+		TraceExporter:  env.string("TRACE_EXPORTER", "none"),
+	}
+	if cfg.LogFormat != "json" && cfg.LogFormat != "text" {
+		env.fail("LOG_FORMAT", cfg.LogFormat, errors.New("must be json or text"))
+	}
+	return cfg, errors.Join(env.errs...)
+}
+
+// envParser reads settings from the environment and keeps the errors of the
+// ones that are invalid, so that they can all be reported at once.
+type envParser struct {
+	errs []error
+}
+
+func (p *envParser) fail(key, value string, err error) {
+	p.errs = append(p.errs, fmt.Errorf("invalid %s %q: %w", key, value, err))
+}
+
+func (p *envParser) bool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		p.fail(key, value, errors.New("must be true or false"))
+		return fallback
+	}
+	return parsed
+}
+
+func (p *envParser) string(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (p *envParser) int64(key string, fallback int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed < 0 {
+		p.fail(key, value, errors.New("must be a non-negative integer"))
+		return fallback
+	}
+	return parsed
+}
+
+func (p *envParser) duration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		p.fail(key, value, errors.New("must be a non-negative duration such as 90s or 12h"))
+		return fallback
+	}
+	return parsed
+}
+
+func (p *envParser) level(key string, fallback slog.Level) slog.Level {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		p.fail(key, value, errors.New("must be debug, info, warn or error"))
+		return fallback
+	}
+	return level
+}
@@ -3,7 +3,10 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"movieLibrary/internal/pkg/helpers"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"log/slog"
 )
 
 const (
@@ -23,10 +26,12 @@ func InitDB() (*sql.DB, error) {
 		DBName,
 		DBPassword,
 	)
-	db, err := sql.Open("postgres", connStr)
+	connector, err := pq.NewConnector(connStr)
 	if err != nil {
-		helpers.ErrorLogger.Println("Error on connection to database:", err)
+		slog.Error("Error on connection to database", "error", err)
 		return nil, err
 	}
-	return db, err
+	db := sql.OpenDB(instrumentedConnector{connector})
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, DBName))
+	return db, nil
 }
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var tracer = otel.Tracer("movieLibrary/internal/database")
+
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "Time taken by SQL statements, by operation.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"operation"})
+
+// instrumentedConnector wraps a driver connector so every statement run on its
+// connections is timed and traced.
+type instrumentedConnector struct {
+	driver.Connector
+}
+
+func (c instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return instrumentedConn{conn}, nil
+}
+
+// instrumentedConn times and traces the queries and commands it is given and
+// passes everything else through to the driver connection.
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, end := startQuery(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		end(err)
+		return nil, err
+	}
+	// Rows stream from the server as they are read, so the query lasts until
+	// they are closed.
+	return &instrumentedRows{Rows: rows, end: end}, nil
+}
+
+func (c instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, end := startQuery(ctx, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	end(err)
+	return result, err
+}
+
+func (c instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c instrumentedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// instrumentedRows ends the span and records the duration of the query that
+// produced them once they are closed, and passes the optional column and
+// result set methods through to the driver rows.
+type instrumentedRows struct {
+	driver.Rows
+	end func(error)
+	err error
+}
+
+func (r *instrumentedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *instrumentedRows) Close() error {
+	err := r.Rows.Close()
+	if r.end != nil {
+		if err == nil {
+			err = r.err
+		}
+		r.end(err)
+		r.end = nil
+	}
+	return err
+}
+
+func (r *instrumentedRows) HasNextResultSet() bool {
+	if sets, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return sets.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *instrumentedRows) NextResultSet() error {
+	if sets, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return sets.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *instrumentedRows) ColumnTypeScanType(index int) reflect.Type {
+	if types, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return types.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (r *instrumentedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if types, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return types.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *instrumentedRows) ColumnTypeLength(index int) (int64, bool) {
+	if types, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return types.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *instrumentedRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if types, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return types.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+// startQuery starts a span for query, a child of the one in ctx, and returns
+// the function that ends it and records its duration once the statement is
+// done with.
+func startQuery(ctx context.Context, query string) (context.Context, func(error)) {
+	start := time.Now()
+	operation := queryOperation(query)
+	ctx, span := tracer.Start(ctx, strings.ToUpper(operation), trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(operation), semconv.DBQueryText(query)))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		queryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	}
+}
+
+// queryOperation names the kind of statement query is by its first keyword.
+func queryOperation(query string) string {
+	keywords := strings.Fields(query)
+	if len(keywords) == 0 {
+		return "other"
+	}
+	switch operation := strings.ToLower(keywords[0]); operation {
+	case "select", "insert", "update", "delete", "with":
+		return operation
+	default:
+		return "other"
+	}
+}
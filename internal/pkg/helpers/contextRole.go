@@ -9,3 +9,19 @@ func GetRoleFromContext(ctx context.Context) string {
 	}
 	return role
 }
+
+func GetUsernameFromContext(ctx context.Context) string {
+	username, ok := ctx.Value("username").(string)
+	if !ok {
+		return ""
+	}
+	return username
+}
+
+func GetRequestIDFromContext(ctx context.Context) string {
+	requestID, ok := ctx.Value("request_id").(string)
+	if !ok {
+		return ""
+	}
+	return requestID
+}
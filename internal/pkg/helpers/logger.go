@@ -1,16 +1,42 @@
 package helpers
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
 )
 
-var (
-	InfoLogger  *log.Logger
-	ErrorLogger *log.Logger
-)
+// InitLogger makes a logger writing to stdout in the given format, "json" or
+// "text", the default slog logger. Records below level are dropped.
+func InitLogger(format string, level slog.Level) {
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stdout, options)
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+// contextHandler adds the request ID and principal stored in the context to
+// every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := GetRequestIDFromContext(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	if principal := GetUsernameFromContext(ctx); principal != "" {
+		record.AddAttrs(slog.String("principal", principal))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
 
-func InitLogger() {
-	InfoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	ErrorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
 }
@@ -0,0 +1,54 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // registered so image.Decode accepts GIF uploads
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Resize scales img down to width pixels wide, keeping its aspect ratio, by
+// averaging the source pixels each destination pixel covers. Images that are
+// already narrow enough are returned unchanged.
+func Resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if width <= 0 || bounds.Dx() <= width {
+		return img
+	}
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// Encode writes img in format, which is "jpg" or "png".
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "jpg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	case "png":
+		return png.Encode(w, img)
+	}
+	return fmt.Errorf("imaging: unsupported format %q", format)
+}
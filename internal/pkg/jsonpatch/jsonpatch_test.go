@@ -0,0 +1,255 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, data string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+	return value
+}
+
+// TestApply runs the examples of RFC 6902 appendix A, plus the edge cases of
+// JSON pointers and array indexes.
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string // empty when the patch must fail
+	}{
+		{
+			name:  "A.1 adding an object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:  "A.2 adding an array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:  "A.3 removing an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "A.4 removing an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "A.5 replacing a value",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:  "A.6 moving a value",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:  "A.7 moving an array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name: "A.8 testing a value: success",
+			doc:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "qux"},
+				{"op": "test", "path": "/foo/1", "value": 2}]`,
+			want: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:  "A.9 testing a value: error",
+			doc:   `{"baz": "qux"}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+		},
+		{
+			name:  "A.10 adding a nested member object",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			want:  `{"foo": "bar", "child": {"grandchild": {}}}`,
+		},
+		{
+			name:  "A.11 ignoring unrecognized elements",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			want:  `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name:  "A.12 adding to a nonexistent target",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+		},
+		{
+			name:  "A.14 ~ escape ordering",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": 10}]`,
+			want:  `{"/": 9, "~1": 10}`,
+		},
+		{
+			name:  "A.15 comparing strings and numbers",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": "10"}]`,
+		},
+		{
+			name:  "A.16 adding an array value",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			want:  `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+		{
+			name:  "~1 escapes a slash",
+			doc:   `{"a/b": 1}`,
+			patch: `[{"op": "replace", "path": "/a~1b", "value": 2}]`,
+			want:  `{"a/b": 2}`,
+		},
+		{
+			name:  "- cannot be removed",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "remove", "path": "/foo/-"}]`,
+		},
+		{
+			name:  "- cannot be replaced",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "replace", "path": "/foo/-", "value": "baz"}]`,
+		},
+		{
+			name:  "index past the end",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/2", "value": "baz"}]`,
+		},
+		{
+			name:  "index with a leading zero",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/01"}]`,
+		},
+		{
+			name:  "index with a sign",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/+1"}]`,
+		},
+		{
+			name:  "adding null",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": null}]`,
+			want:  `{"foo": "bar", "baz": null}`,
+		},
+		{
+			name:  "missing value",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz"}]`,
+		},
+		{
+			name:  "replacing the whole document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "", "value": {"baz": "qux"}}]`,
+			want:  `{"baz": "qux"}`,
+		},
+		{
+			name:  "copying a value is independent of the source",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "copy", "from": "/foo", "path": "/baz"}, {"op": "add", "path": "/baz/bar", "value": 2}]`,
+			want:  `{"foo": {"bar": 1}, "baz": {"bar": 2}}`,
+		},
+		{
+			name:  "moving a value into its child",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo/baz"}]`,
+		},
+		{
+			name:  "unsupported operation",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "frobnicate", "path": "/foo"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []Operation
+			if err := json.Unmarshal([]byte(tt.patch), &ops); err != nil {
+				t.Fatalf("decoding patch: %v", err)
+			}
+			got, err := Apply(decode(t, tt.doc), ops)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("Apply() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("Apply() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestApplyAtomic checks that a patch whose test fails leaves the document as
+// it was, including the operations applied before the test.
+func TestApplyAtomic(t *testing.T) {
+	doc := decode(t, `{"foo": ["bar"], "baz": "qux"}`)
+	var ops []Operation
+	err := json.Unmarshal([]byte(`[
+		{"op": "add", "path": "/foo/-", "value": "added"},
+		{"op": "remove", "path": "/baz"},
+		{"op": "test", "path": "/foo/0", "value": "not bar"}
+	]`), &ops)
+	if err != nil {
+		t.Fatalf("decoding patch: %v", err)
+	}
+	got, err := Apply(doc, ops)
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("Apply() = %v, %v, want ErrTestFailed", got, err)
+	}
+	if want := decode(t, `{"foo": ["bar"], "baz": "qux"}`); !reflect.DeepEqual(doc, want) {
+		t.Errorf("document after failed patch = %v, want %v", doc, want)
+	}
+}
+
+// TestMergePatch runs the examples of RFC 7396 appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.doc+" "+tt.patch, func(t *testing.T) {
+			got := MergePatch(decode(t, tt.doc), decode(t, tt.patch))
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("MergePatch() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned by Get when no object is stored under the key.
+var ErrNotFound = errors.New("storage: object not found")
+
+// Store keeps binary objects, such as uploaded images, under slash separated
+// keys like "movies/12/poster-1f2e/original.jpg".
+type Store interface {
+	// Put stores the contents of r under key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens the object stored under key. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key. Deleting a missing object
+	// is not an error.
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,62 @@
+// Package tracing sets up OpenTelemetry tracing with W3C trace context
+// propagation.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ServiceName identifies the application in exported spans unless
+// OTEL_SERVICE_NAME overrides it.
+const ServiceName = "movie_library"
+
+// Init installs the global propagator, which reads and writes the W3C
+// traceparent and baggage headers, and a tracer provider sending spans to the
+// named exporter:
+//
+//   - "otlp" exports over OTLP/HTTP, configured by the standard
+//     OTEL_EXPORTER_OTLP_* environment variables.
+//   - "stdout" prints every span as JSON as soon as it ends.
+//   - "none" records no spans, though trace context is still propagated.
+func Init(ctx context.Context, exporter string) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var processor sdktrace.SpanProcessor
+	switch exporter {
+	case "none":
+		return nil
+	case "otlp":
+		otlpExporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return err
+		}
+		processor = sdktrace.NewBatchSpanProcessor(otlpExporter)
+	case "stdout":
+		stdoutExporter, err := stdouttrace.New()
+		if err != nil {
+			return err
+		}
+		processor = sdktrace.NewSimpleSpanProcessor(stdoutExporter)
+	default:
+		return fmt.Errorf("unknown trace exporter %q, want otlp, stdout or none", exporter)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return err
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor), sdktrace.WithResource(res)))
+	return nil
+}
@@ -1,6 +1,11 @@
 package validation
 
-import "strconv"
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
 
 func Name(name string) bool {
 	return len(name) > 0 && len(name) <= 150
@@ -17,3 +22,80 @@ func Rating(rating string) bool {
 	}
 	return ratingFloat >= 0 && ratingFloat <= 10
 }
+
+func Date(date string) bool {
+	_, err := time.Parse("2006-01-02", date)
+	return err == nil
+}
+
+func CreditType(creditType string) bool {
+	switch creditType {
+	case "lead", "supporting", "cameo", "voice":
+		return true
+	}
+	return false
+}
+
+func CrewRole(role string) bool {
+	switch role {
+	case "director", "writer", "producer", "composer", "cinematographer":
+		return true
+	}
+	return false
+}
+
+// Label validates short taxonomy names such as genres and tags.
+func Label(label string) bool {
+	return len(label) > 0 && len(label) <= 50
+}
+
+func RuntimeMinutes(minutes int) bool {
+	return minutes > 0 && minutes <= 1500
+}
+
+// LanguageCode validates an ISO 639-1 language code such as "en".
+func LanguageCode(code string) bool {
+	return len(code) == 2 && code[0] >= 'a' && code[0] <= 'z' && code[1] >= 'a' && code[1] <= 'z'
+}
+
+// LanguageTag validates a language tag such as "en" or "pt-BR", made of an
+// ISO 639-1 code optionally followed by an ISO 3166-1 region.
+func LanguageTag(tag string) bool {
+	base, region, found := strings.Cut(tag, "-")
+	return LanguageCode(base) && (!found || CountryCode(region))
+}
+
+// CountryCode validates an ISO 3166-1 alpha-2 country code such as "US".
+func CountryCode(code string) bool {
+	return len(code) == 2 && code[0] >= 'A' && code[0] <= 'Z' && code[1] >= 'A' && code[1] <= 'Z'
+}
+
+// ImdbID validates an IMDb title identifier such as "tt0133093".
+func ImdbID(id string) bool {
+	return imdbIDPattern.MatchString(id)
+}
+
+var imdbIDPattern = regexp.MustCompile(`^tt[0-9]{7,10}$`)
+
+func ReviewBody(body string) bool {
+	return len(body) > 0 && len(body) <= 10000
+}
+
+// MovieRelation validates the relation of one movie to another as accepted
+// by the API.
+func MovieRelation(relation string) bool {
+	switch relation {
+	case "sequel", "prequel", "remake":
+		return true
+	}
+	return false
+}
+
+// AliasKind validates the kind of another name an actor is known by.
+func AliasKind(kind string) bool {
+	switch kind {
+	case "stage", "birth", "transliteration", "other":
+		return true
+	}
+	return false
+}
@@ -1,30 +1,53 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	_ "github.com/lib/pq"
-	"log"
+	"log/slog"
 	"movieLibrary/internal/api"
+	"movieLibrary/internal/config"
 	"movieLibrary/internal/database"
 	"movieLibrary/internal/pkg/helpers"
+	"movieLibrary/internal/pkg/storage"
+	"movieLibrary/internal/pkg/tracing"
 	"net/http"
+	"os"
 )
 
 func main() {
-	helpers.InitLogger()
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("Error loading configuration", err)
+	}
+	helpers.InitLogger(cfg.LogFormat, cfg.LogLevel)
+	if err := tracing.Init(context.Background(), cfg.TraceExporter); err != nil {
+		fatal("Error setting up tracing", err)
+	}
 
 	db, err := database.InitDB()
 	if err != nil {
-		log.Fatalf("Error connecting to the database: %v", err)
+		fatal("Error connecting to the database", err)
 	}
 	defer func(db *sql.DB) {
 		err := db.Close()
 		if err != nil {
-			log.Fatalf("Error closing database: %v", err)
+			fatal("Error closing database", err)
 		}
 	}(db)
 
-	router := api.StartApi(db)
-	log.Println("App is working on port :8080")
-	log.Fatal(http.ListenAndServe(":8080", router))
+	media, err := storage.NewLocalStore(cfg.MediaDir)
+	if err != nil {
+		fatal("Error opening media storage", err)
+	}
+
+	api.StartPurgeJob(context.Background(), db, cfg, media)
+
+	router := api.StartApi(db, cfg, media)
+	slog.Info("App is working on port :8080")
+	fatal("Error serving HTTP", http.ListenAndServe(":8080", router))
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,11 @@
+-- init/init.sql only runs against an empty database. Existing databases are
+-- upgraded by running the scripts in this directory once each, in the order of
+-- their numbers, which are those of the changes that need them. Every script
+-- can be run again safely.
+--
+-- Movies and actors carry a version, checked against If-Match, and the time
+-- they were last changed.
+ALTER TABLE actors ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE actors ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
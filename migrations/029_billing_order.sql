@@ -0,0 +1,3 @@
+-- Cast links are ordered; existing links are numbered by the next cast edit of
+-- their movie, after the ordered ones.
+ALTER TABLE movies_actors ADD COLUMN IF NOT EXISTS billing_order INT;
@@ -0,0 +1,4 @@
+-- Cast links record the characters played and the kind of credit.
+ALTER TABLE movies_actors ADD COLUMN IF NOT EXISTS characters TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE movies_actors ADD COLUMN IF NOT EXISTS credit_type VARCHAR(20)
+    CHECK (credit_type IN ('lead', 'supporting', 'cameo', 'voice'));
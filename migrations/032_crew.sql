@@ -0,0 +1,20 @@
+-- Crew members and their roles on movies.
+CREATE TABLE IF NOT EXISTS people (
+    person_id SERIAL PRIMARY KEY,
+    name VARCHAR(150) NOT NULL,
+    date_of_birth DATE
+);
+
+ALTER TABLE people OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS movies_crew (
+    movie_id INT REFERENCES movies(movie_id),
+    person_id INT REFERENCES people(person_id),
+    role VARCHAR(30) NOT NULL CHECK (role IN ('director', 'writer', 'producer', 'composer', 'cinematographer')),
+    PRIMARY KEY (movie_id, person_id, role)
+);
+
+ALTER TABLE movies_crew OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS person_name_index ON people(name);
+CREATE INDEX IF NOT EXISTS movies_crew_person_index ON movies_crew(person_id);
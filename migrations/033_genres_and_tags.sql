@@ -0,0 +1,27 @@
+-- Genres and free-form tags of movies.
+CREATE TABLE IF NOT EXISTS genres (
+    genre_id SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL
+);
+
+ALTER TABLE genres OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS movies_genres (
+    movie_id INT REFERENCES movies(movie_id),
+    genre_id INT REFERENCES genres(genre_id),
+    PRIMARY KEY (movie_id, genre_id)
+);
+
+ALTER TABLE movies_genres OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS movie_tags (
+    movie_id INT REFERENCES movies(movie_id),
+    tag VARCHAR(50) NOT NULL,
+    PRIMARY KEY (movie_id, tag)
+);
+
+ALTER TABLE movie_tags OWNER TO postgres;
+
+CREATE UNIQUE INDEX IF NOT EXISTS genre_name_index ON genres(lower(name));
+CREATE INDEX IF NOT EXISTS movies_genres_genre_index ON movies_genres(genre_id);
+CREATE INDEX IF NOT EXISTS movie_tags_tag_index ON movie_tags(tag);
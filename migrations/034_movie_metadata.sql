@@ -0,0 +1,18 @@
+-- Extended movie metadata, external IDs and certifications by country.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS runtime_minutes INT CHECK (runtime_minutes > 0);
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS original_title VARCHAR(150);
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS original_language CHAR(2);
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS countries CHAR(2)[] NOT NULL DEFAULT '{}';
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS budget BIGINT CHECK (budget >= 0);
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS box_office BIGINT CHECK (box_office >= 0);
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS imdb_id VARCHAR(12) UNIQUE;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS tmdb_id INT UNIQUE;
+
+CREATE TABLE IF NOT EXISTS movie_certifications (
+    movie_id INT REFERENCES movies(movie_id),
+    country CHAR(2) NOT NULL,
+    certification VARCHAR(50) NOT NULL,
+    PRIMARY KEY (movie_id, country)
+);
+
+ALTER TABLE movie_certifications OWNER TO postgres;
@@ -0,0 +1,21 @@
+-- Per-user ratings. movies.rating now holds the editorial rating and is
+-- renamed accordingly.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'movies' AND column_name = 'rating') THEN
+        ALTER TABLE movies RENAME COLUMN rating TO editorial_rating;
+    END IF;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS movie_ratings (
+    movie_id INT REFERENCES movies(movie_id),
+    username VARCHAR(50) REFERENCES users(username),
+    score NUMERIC(3,1) NOT NULL CHECK (score >= 0 AND score <= 10),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (movie_id, username)
+);
+
+ALTER TABLE movie_ratings OWNER TO postgres;
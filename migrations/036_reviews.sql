@@ -0,0 +1,31 @@
+-- User reviews and the log of their moderation.
+CREATE TABLE IF NOT EXISTS reviews (
+    review_id SERIAL PRIMARY KEY,
+    movie_id INT NOT NULL REFERENCES movies(movie_id),
+    username VARCHAR(50) NOT NULL REFERENCES users(username),
+    title VARCHAR(150) NOT NULL,
+    body TEXT NOT NULL,
+    spoiler BOOLEAN NOT NULL DEFAULT false,
+    hidden BOOLEAN NOT NULL DEFAULT false,
+    moderation_reason VARCHAR(1000),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (movie_id, username)
+);
+
+ALTER TABLE reviews OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS review_moderations (
+    moderation_id SERIAL PRIMARY KEY,
+    review_id INT NOT NULL,
+    movie_id INT NOT NULL,
+    author VARCHAR(50) NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('hide', 'unhide', 'delete')),
+    reason VARCHAR(1000),
+    moderator VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE review_moderations OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS reviews_username_index ON reviews(username);
@@ -0,0 +1,19 @@
+-- Per-user watchlist and watched history.
+CREATE TABLE IF NOT EXISTS watchlist (
+    username VARCHAR(50) REFERENCES users(username),
+    movie_id INT REFERENCES movies(movie_id),
+    added_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (username, movie_id)
+);
+
+ALTER TABLE watchlist OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS watched (
+    username VARCHAR(50) REFERENCES users(username),
+    movie_id INT REFERENCES movies(movie_id),
+    watched_on DATE NOT NULL DEFAULT current_date,
+    rewatch_count INT NOT NULL DEFAULT 0 CHECK (rewatch_count >= 0),
+    PRIMARY KEY (username, movie_id)
+);
+
+ALTER TABLE watched OWNER TO postgres;
@@ -0,0 +1,24 @@
+-- User-curated movie collections.
+CREATE TABLE IF NOT EXISTS collections (
+    collection_id SERIAL PRIMARY KEY,
+    username VARCHAR(50) NOT NULL REFERENCES users(username),
+    name VARCHAR(150) NOT NULL,
+    description VARCHAR(1000),
+    public BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE collections OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS collection_entries (
+    collection_id INT REFERENCES collections(collection_id),
+    movie_id INT REFERENCES movies(movie_id),
+    position INT NOT NULL,
+    note VARCHAR(1000),
+    PRIMARY KEY (collection_id, movie_id)
+);
+
+ALTER TABLE collection_entries OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS collections_username_index ON collections(username);
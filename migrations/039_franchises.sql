@@ -0,0 +1,31 @@
+-- Franchises and sequel, prequel and remake relations between movies.
+CREATE TABLE IF NOT EXISTS franchises (
+    franchise_id SERIAL PRIMARY KEY,
+    name VARCHAR(150) NOT NULL,
+    description VARCHAR(1000)
+);
+
+ALTER TABLE franchises OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS franchise_movies (
+    franchise_id INT NOT NULL REFERENCES franchises(franchise_id),
+    movie_id INT PRIMARY KEY REFERENCES movies(movie_id),
+    position INT NOT NULL
+);
+
+ALTER TABLE franchise_movies OWNER TO postgres;
+
+-- A row (a, b, 'sequel') says b is the sequel of a; (a, b, 'remake') says b
+-- is a remake of a.
+CREATE TABLE IF NOT EXISTS movie_relations (
+    movie_id INT REFERENCES movies(movie_id),
+    related_movie_id INT REFERENCES movies(movie_id),
+    relation VARCHAR(10) NOT NULL CHECK (relation IN ('sequel', 'remake')),
+    PRIMARY KEY (movie_id, related_movie_id),
+    CHECK (movie_id <> related_movie_id)
+);
+
+ALTER TABLE movie_relations OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS franchise_movies_franchise_index ON franchise_movies(franchise_id, position);
+CREATE INDEX IF NOT EXISTS movie_relations_related_index ON movie_relations(related_movie_id);
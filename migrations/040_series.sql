@@ -0,0 +1,48 @@
+-- TV series with their seasons, episodes and guest cast.
+CREATE TABLE IF NOT EXISTS series (
+    series_id SERIAL PRIMARY KEY,
+    name VARCHAR(150) NOT NULL,
+    description TEXT,
+    first_air_date DATE,
+    last_air_date DATE,
+    rating FLOAT
+);
+
+ALTER TABLE series OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS seasons (
+    season_id SERIAL PRIMARY KEY,
+    series_id INT NOT NULL REFERENCES series(series_id),
+    number INT NOT NULL CHECK (number > 0),
+    name VARCHAR(150),
+    description TEXT,
+    UNIQUE (series_id, number)
+);
+
+ALTER TABLE seasons OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS episodes (
+    episode_id SERIAL PRIMARY KEY,
+    season_id INT NOT NULL REFERENCES seasons(season_id),
+    number INT NOT NULL CHECK (number > 0),
+    name VARCHAR(150) NOT NULL,
+    description TEXT,
+    air_date DATE,
+    runtime_minutes INT CHECK (runtime_minutes > 0),
+    rating FLOAT,
+    UNIQUE (season_id, number)
+);
+
+ALTER TABLE episodes OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS episodes_actors (
+    episode_id INT REFERENCES episodes(episode_id),
+    actor_id INT REFERENCES actors(actor_id),
+    characters TEXT[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (episode_id, actor_id)
+);
+
+ALTER TABLE episodes_actors OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS series_name_index ON series(name);
+CREATE INDEX IF NOT EXISTS episodes_actors_actor_index ON episodes_actors(actor_id);
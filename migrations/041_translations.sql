@@ -0,0 +1,22 @@
+-- Translated names and descriptions of movies and actors.
+CREATE TABLE IF NOT EXISTS movie_translations (
+    movie_id INT REFERENCES movies(movie_id),
+    language VARCHAR(5) NOT NULL,
+    name VARCHAR(150) NOT NULL,
+    description TEXT,
+    PRIMARY KEY (movie_id, language)
+);
+
+ALTER TABLE movie_translations OWNER TO postgres;
+
+CREATE TABLE IF NOT EXISTS actor_translations (
+    actor_id INT REFERENCES actors(actor_id),
+    language VARCHAR(5) NOT NULL,
+    name VARCHAR(150) NOT NULL,
+    PRIMARY KEY (actor_id, language)
+);
+
+ALTER TABLE actor_translations OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS movie_translations_name_index ON movie_translations(name);
+CREATE INDEX IF NOT EXISTS actor_translations_name_index ON actor_translations(name);
@@ -0,0 +1,18 @@
+-- Posters, backdrops and actor photos. An image belongs to exactly one movie
+-- or actor; its original and thumbnails are stored under storage_key.
+CREATE TABLE IF NOT EXISTS images (
+    image_id SERIAL PRIMARY KEY,
+    movie_id INT REFERENCES movies(movie_id),
+    actor_id INT REFERENCES actors(actor_id),
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('poster', 'backdrop', 'photo')),
+    storage_key VARCHAR(200) NOT NULL UNIQUE,
+    content_type VARCHAR(50) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (movie_id, kind),
+    UNIQUE (actor_id, kind),
+    CHECK ((movie_id IS NULL) <> (actor_id IS NULL))
+);
+
+ALTER TABLE images OWNER TO postgres;
@@ -0,0 +1,12 @@
+-- Other names actors are known by.
+CREATE TABLE IF NOT EXISTS actor_aliases (
+    alias_id SERIAL PRIMARY KEY,
+    actor_id INT NOT NULL REFERENCES actors(actor_id),
+    name VARCHAR(150) NOT NULL,
+    kind VARCHAR(20) NOT NULL DEFAULT 'other' CHECK (kind IN ('stage', 'birth', 'transliteration', 'other')),
+    UNIQUE (actor_id, name)
+);
+
+ALTER TABLE actor_aliases OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS actor_aliases_name_index ON actor_aliases(name);
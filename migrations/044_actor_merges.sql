@@ -0,0 +1,20 @@
+-- Audit trail of duplicate actors merged into a surviving actor. The target
+-- is a plain ID so that an actor that was the target of a merge can itself be
+-- merged or purged; databases that got the table with a foreign key on it
+-- lose that key.
+CREATE TABLE IF NOT EXISTS actor_merges (
+    merge_id SERIAL PRIMARY KEY,
+    source_actor_id INT NOT NULL,
+    source_name VARCHAR(150) NOT NULL,
+    source_date_of_birth DATE,
+    target_actor_id INT NOT NULL,
+    movie_ids INT[] NOT NULL DEFAULT '{}',
+    merged_by VARCHAR(50) NOT NULL,
+    merged_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE actor_merges OWNER TO postgres;
+
+ALTER TABLE actor_merges DROP CONSTRAINT IF EXISTS actor_merges_target_actor_id_fkey;
+
+CREATE INDEX IF NOT EXISTS actor_merges_source_index ON actor_merges(source_actor_id);
@@ -0,0 +1,6 @@
+-- Deleted movies and actors stay in the trash until the purge job removes them.
+ALTER TABLE actors ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS movies_deleted_at_index ON movies(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS actors_deleted_at_index ON actors(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,18 @@
+-- Every change of a movie or actor: the state after the change and the fields
+-- that differ from the previous revision. Existing movies and actors get their
+-- first revision with their next change.
+CREATE TABLE IF NOT EXISTS revisions (
+    revision_id SERIAL PRIMARY KEY,
+    entity_type VARCHAR(10) NOT NULL CHECK (entity_type IN ('movie', 'actor')),
+    entity_id INT NOT NULL,
+    version INT NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore', 'revert', 'merge')),
+    snapshot JSONB NOT NULL,
+    changes JSONB NOT NULL DEFAULT '{}',
+    changed_by VARCHAR(50) NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE revisions OWNER TO postgres;
+
+CREATE INDEX IF NOT EXISTS revisions_entity_index ON revisions(entity_type, entity_id, revision_id);
@@ -0,0 +1,32 @@
+-- Append-only record of every request that changed data and of
+-- authentications.
+CREATE TABLE IF NOT EXISTS audit_log (
+    audit_id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    principal VARCHAR(50) NOT NULL,
+    action VARCHAR(100) NOT NULL,
+    resource_type VARCHAR(50) NOT NULL,
+    resource_id VARCHAR(100) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(200) NOT NULL,
+    request_id VARCHAR(100) NOT NULL,
+    source_ip VARCHAR(45) NOT NULL,
+    outcome VARCHAR(10) NOT NULL CHECK (outcome IN ('success', 'failure')),
+    status INT NOT NULL
+);
+
+ALTER TABLE audit_log OWNER TO postgres;
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+CREATE INDEX IF NOT EXISTS audit_log_occurred_at_index ON audit_log(occurred_at);
+CREATE INDEX IF NOT EXISTS audit_log_principal_index ON audit_log(principal);
+CREATE INDEX IF NOT EXISTS audit_log_resource_index ON audit_log(resource_type, resource_id);